@@ -1,2 +1,2 @@
 #!/bin/sh
-go build && ./ec-sim-zs
+go build -o ec-sim-zs && ./ec-sim-zs
@@ -0,0 +1,496 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// z score for a two-sided 95% confidence interval
+const ciZ = 1.96
+
+//**** Per-chain metrics
+
+// firstMeasured returns the lowest height the per-height metrics look at: the
+// oldest height kept by prune, or the end of a warmup of that many heights
+// if that's later.
+func (ct *ChainTracker) firstMeasured(warmup int) int {
+	if warmup > ct.prunedBelow {
+		return warmup
+	}
+	return ct.prunedBelow
+}
+
+// averageLiveForksPerRound returns the mean number of live (non-null) blocks
+// seen per height, i.e. the number of possible mining heads per round.
+// Heights pruned away or in the warmup aren't counted.
+func averageLiveForksPerRound(ct *ChainTracker, warmup int) float64 {
+	from := ct.firstMeasured(warmup)
+	if ct.maxHeight < from {
+		return 0
+	}
+	total := 0
+	for h := from; h <= ct.maxHeight; h++ {
+		total += len(ct.liveBlocksByHeight[h])
+	}
+	return float64(total) / float64(ct.maxHeight+1-from)
+}
+
+// headAncestry returns the nonces of the non-null blocks in the head tipset
+// and all of its ancestors down to genesis, i.e. the canonical chain.  In a
+// pruned chain it stops at the oldest block kept.
+func headAncestry(ct *ChainTracker) map[int]bool {
+	ancestry := make(map[int]bool)
+	for ts := ct.head; ; ts = ts.getParents() {
+		for _, blk := range ts.Blocks {
+			if !blk.Null {
+				ancestry[blk.Nonce] = true
+			}
+		}
+		// genesis ancestors only exist for sampling lookback tickets
+		if ts.Blocks[0].Owner == -1 || ts.getHeight() <= ct.prunedBelow {
+			return ancestry
+		}
+	}
+}
+
+// liveBlockCount returns the number of non-null blocks mined, genesis included.
+func liveBlockCount(ct *ChainTracker) int {
+	count := 0
+	for _, blocks := range ct.liveBlocksByHeight {
+		count += len(blocks)
+	}
+	return count
+}
+
+// measuredBlockCount returns the number of non-null blocks mined at heights
+// the per-height metrics look at.  Genesis, or the oldest blocks kept if
+// pruned, weren't mined.
+func measuredBlockCount(ct *ChainTracker, warmup int) int {
+	count := 0
+	for h := ct.firstMeasured(warmup); h <= ct.maxHeight; h++ {
+		if h != ct.prunedBelow {
+			count += len(ct.liveBlocksByHeight[h])
+		}
+	}
+	return count
+}
+
+// orphanCount returns the number of non-null blocks that did not make it into
+// the canonical chain, leaving out those in the warmup.
+func orphanCount(ct *ChainTracker, warmup int) int {
+	ancestry := headAncestry(ct)
+	count := 0
+	for h := ct.firstMeasured(warmup); h <= ct.maxHeight; h++ {
+		for _, blk := range ct.liveBlocksByHeight[h] {
+			if !ancestry[blk.Nonce] {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// orphanRate returns the fraction of mined non-null blocks that did not make it
+// into the canonical chain, leaving out those in the warmup.
+func orphanRate(ct *ChainTracker, warmup int) float64 {
+	mined := measuredBlockCount(ct, warmup)
+	if mined == 0 {
+		return 0
+	}
+	return float64(orphanCount(ct, warmup)) / float64(mined)
+}
+
+// throughput returns the transactions confirmed by the canonical chain per
+// round past the warmup, each of its blocks carrying ct.txPerBlock, and the
+// transactions per round carried by orphaned blocks instead.  An orphaned
+// block's transactions are lost with it and must be included again by a
+// later block, so forks cost transaction capacity.
+func throughput(ct *ChainTracker, warmup int) (confirmed, lost float64) {
+	rounds := ct.maxHeight - ct.firstMeasured(warmup) + 1
+	if rounds <= 0 {
+		return 0, 0
+	}
+	orphans := orphanCount(ct, warmup)
+	canonical := measuredBlockCount(ct, warmup) - orphans
+	perRound := float64(ct.txPerBlock) / float64(rounds)
+	return float64(canonical) * perRound, float64(orphans) * perRound
+}
+
+// blockRateStats returns the mean and variance of the number of non-null
+// blocks mined per round.  Each honest miner wins with probability equal to
+// its power, so a network of honest miners should average about 1.
+func blockRateStats(ct *ChainTracker) (float64, float64) {
+	rates := make([]float64, len(ct.blocksPerRound))
+	for i, n := range ct.blocksPerRound {
+		rates[i] = float64(n)
+	}
+	return meanAndVariance(rates)
+}
+
+// adversaryIDs returns the IDs of the miners tagged as adversaries
+func adversaryIDs(ct *ChainTracker) map[int]bool {
+	ids := make(map[int]bool)
+	for _, m := range ct.miners {
+		if m.Adversarial() {
+			ids[m.ID()] = true
+		}
+	}
+	return ids
+}
+
+// chainQuality returns the fraction of canonical blocks over the last window
+// heights that were mined by non-adversarial miners.  A window of 0 or less
+// covers the whole chain.  Genesis, or the oldest blocks kept if pruned,
+// aren't counted.
+func chainQuality(ct *ChainTracker, adversaryIDs map[int]bool, window int) float64 {
+	lowest := ct.prunedBelow + 1
+	if window > 0 && ct.maxHeight-window+1 > lowest {
+		lowest = ct.maxHeight - window + 1
+	}
+
+	honest, total := 0, 0
+	for ts := ct.head; ts.getHeight() >= lowest; ts = ts.getParents() {
+		for _, blk := range ts.Blocks {
+			if blk.Null {
+				continue
+			}
+			total++
+			if !adversaryIDs[blk.Owner] {
+				honest++
+			}
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(honest) / float64(total)
+}
+
+// weightGrowth returns the weight of the canonical chain at each height from
+// 0 to maxHeight.  Heights where the canonical chain only has null blocks
+// keep the weight of the height below.
+func weightGrowth(ct *ChainTracker) []int {
+	if ct.maxHeight < 0 {
+		return nil
+	}
+	canonAt := make(map[int]int)
+	for ts := ct.head; ; ts = ts.getParents() {
+		if !ts.Blocks[0].Null && ts.getHeight() <= ct.maxHeight {
+			if _, ok := canonAt[ts.getHeight()]; !ok {
+				canonAt[ts.getHeight()] = ts.Weight
+			}
+		}
+		// genesis, or the oldest block kept of a pruned chain
+		if ts.Blocks[0].Owner == -1 || ts.getParents() == nil {
+			break
+		}
+	}
+
+	weights := make([]int, ct.maxHeight+1)
+	for h := range weights {
+		if w, ok := canonAt[h]; ok {
+			weights[h] = w
+		} else if h > 0 {
+			weights[h] = weights[h-1]
+		}
+	}
+	return weights
+}
+
+// weightGrowthRate returns the average weight the canonical chain gained per
+// round after the warmup, or since the oldest height kept if pruned.  Null
+// blocks in the canonical chain slow it down.
+func weightGrowthRate(ct *ChainTracker, warmup int) float64 {
+	weights := weightGrowth(ct)
+	if first := ct.firstMeasured(warmup); first < len(weights) {
+		weights = weights[first:]
+	}
+	if len(weights) < 2 {
+		return 0
+	}
+	return float64(weights[len(weights)-1]-weights[0]) / float64(len(weights)-1)
+}
+
+// wastedWorkFraction returns the fraction of mining attempts that added no
+// weight to the canonical chain: null blocks plus orphaned live blocks.
+// Blocks still pending delivery count as neither.  Attempts in the warmup
+// aren't counted.
+func wastedWorkFraction(ct *ChainTracker, warmup int) float64 {
+	attempts := 0
+	for h, n := range ct.attempts {
+		if h >= warmup {
+			attempts += n
+		}
+	}
+	if attempts == 0 {
+		return 0
+	}
+	// genesis isn't mined, and attempts at the oldest height kept by prune
+	// are dropped with it
+	live := measuredBlockCount(ct, warmup) + len(ct.pending)
+	nulls := attempts - live
+	return float64(nulls+orphanCount(ct, warmup)) / float64(attempts)
+}
+
+//**** Suite statistics
+
+// meanAndVariance returns the sample mean and unbiased sample variance of values.
+func meanAndVariance(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, sq / float64(len(values)-1)
+}
+
+// summarize returns the sample mean and standard deviation of values and
+// the bounds of the 95% confidence interval on the mean.
+func summarize(values []float64) (mean, stddev, ciLow, ciHigh float64) {
+	mean, variance := meanAndVariance(values)
+	stddev = math.Sqrt(variance)
+	if len(values) == 0 {
+		return mean, stddev, mean, mean
+	}
+	half := ciZ * stddev / math.Sqrt(float64(len(values)))
+	return mean, stddev, mean - half, mean + half
+}
+
+// printSummary prints the mean of a per-trial metric with its standard
+// deviation and 95% confidence interval.
+func printSummary(label string, values []float64) {
+	mean, stddev, lo, hi := summarize(values)
+	reportf("%s: %f (sd %f, 95%% CI [%f, %f])\n", label, mean, stddev, lo, hi)
+}
+
+// trialsForCIWidth estimates, from the variance observed in a pilot run, how
+// many trials are needed for the 95% confidence interval on the fork-rate
+// metric to be no wider than targetWidth (the full width, i.e. 2*z*s/sqrt(n)).
+// The first warmup heights of each trial aren't measured.  It returns an
+// error unless targetWidth is positive.
+func trialsForCIWidth(pilotCts []*ChainTracker, targetWidth float64, warmup int) (int, error) {
+	if targetWidth <= 0 {
+		return 0, fmt.Errorf("target CI width %g must be positive", targetWidth)
+	}
+
+	forks := make([]float64, 0, len(pilotCts))
+	for _, ct := range pilotCts {
+		forks = append(forks, averageLiveForksPerRound(ct, warmup))
+	}
+	_, variance := meanAndVariance(forks)
+
+	n := int(math.Ceil(math.Pow(2*ciZ*math.Sqrt(variance)/targetWidth, 2)))
+	if n < 2 {
+		// can't compute a sample variance from fewer than two trials
+		n = 2
+	}
+	return n, nil
+}
+
+// stallRate returns the fraction of rounds in which every active miner's
+// election came out null, stalling the network.
+func stallRate(ct *ChainTracker) float64 {
+	if len(ct.blocksPerRound) == 0 {
+		return 0
+	}
+	return float64(ct.stalls) / float64(len(ct.blocksPerRound))
+}
+
+// analysisParams holds the parameters of the metrics computed by analyzeSim
+type analysisParams struct {
+	// weight lead over competing forks at which a height is final
+	confidence int
+	// number of most recent heights chain quality is measured over
+	qualityWindow int
+	// number of heights in each window of giniSeries
+	giniWindow int
+	// number of heights after genesis left out of the per-height metrics,
+	// see firstMeasured
+	warmup int
+}
+
+// analyzeSim prints summary statistics over all trials of a suite.
+func analyzeSim(cts []*ChainTracker, ap *analysisParams) {
+	sa := newSuiteAnalysis(ap)
+	for _, ct := range cts {
+		sa.add(ct)
+	}
+	sa.print(cts)
+}
+
+// suiteAnalysis gathers the statistics analyzeSim prints one trial at a
+// time, so that suites streaming their trials needn't keep every chain, see
+// streamTrials.
+type suiteAnalysis struct {
+	ap     *analysisParams
+	trials int
+	// settings of the suite, taken from its first trial
+	txPerBlock int
+	blockTime  time.Duration
+
+	forks, orphans, wasted, finality []float64
+	rateMeans, rateVars              []float64
+	quality, growth                  []float64
+	reorgs, disagreements            []float64
+	nullRuns, stalls, nakamoto       []float64
+	confirmedTx, lostTx              []float64
+	gaps, giniMeans, giniTrends      []float64
+	firstForks                       []float64
+	slashings, maxSplit, maxReorg    int
+	nullHist, hist, sizes            map[int]int
+	lifetimes                        []int
+	// quantiles of average live forks per round, fed in trial order
+	forkRates *Quantiles
+}
+
+func newSuiteAnalysis(ap *analysisParams) *suiteAnalysis {
+	return &suiteAnalysis{
+		ap:        ap,
+		nullHist:  make(map[int]int),
+		hist:      make(map[int]int),
+		sizes:     make(map[int]int),
+		forkRates: NewQuantiles(forkRateQuantiles...),
+	}
+}
+
+// add gathers the statistics of the suite's next trial
+func (sa *suiteAnalysis) add(ct *ChainTracker) {
+	if sa.trials == 0 {
+		sa.txPerBlock, sa.blockTime = ct.txPerBlock, ct.blockTime
+	}
+	sa.trials++
+	warmup := sa.ap.warmup
+	for k, v := range forkHistogram(ct, warmup) {
+		sa.hist[k] += v
+	}
+	for k, v := range tipsetSizeDistribution(ct, warmup) {
+		sa.sizes[k] += v
+	}
+	sa.lifetimes = append(sa.lifetimes, forkLifetimes(ct)...)
+	sa.reorgs = append(sa.reorgs, float64(len(ct.reorgEvents)))
+	if ct.countDisagreements {
+		sa.disagreements = append(sa.disagreements, float64(ct.forkChoiceDisagreements))
+	}
+	for _, ev := range ct.reorgEvents {
+		if ev.Depth > sa.maxReorg {
+			sa.maxReorg = ev.Depth
+		}
+	}
+	run := maxNullRun(ct)
+	sa.nullRuns = append(sa.nullRuns, float64(run))
+	sa.stalls = append(sa.stalls, stallRate(ct))
+	sa.nakamoto = append(sa.nakamoto, float64(nakamotoCoefficient(ct)))
+	if series := giniSeries(ct, sa.ap.giniWindow, warmup); len(series) > 0 {
+		var sum float64
+		for _, g := range series {
+			sum += g
+		}
+		sa.giniMeans = append(sa.giniMeans, sum/float64(len(series)))
+		sa.giniTrends = append(sa.giniTrends, trend(series))
+	}
+	sa.nullHist[run]++
+	if len(weightGaps(ct, warmup)) > 0 {
+		sa.gaps = append(sa.gaps, avgWeightGap(ct, warmup))
+	}
+	if s := longestSplit(ct); s > sa.maxSplit {
+		sa.maxSplit = s
+	}
+	if f := timeToFirstFork(ct); f >= 0 {
+		sa.firstForks = append(sa.firstForks, float64(f))
+	}
+	sa.growth = append(sa.growth, weightGrowthRate(ct, warmup))
+	sa.quality = append(sa.quality, chainQuality(ct, adversaryIDs(ct), sa.ap.qualityWindow))
+	sa.slashings += len(slashingDetector(ct))
+	mean, variance := blockRateStats(ct)
+	sa.rateMeans = append(sa.rateMeans, mean)
+	sa.rateVars = append(sa.rateVars, variance)
+	forks := averageLiveForksPerRound(ct, warmup)
+	sa.forks = append(sa.forks, forks)
+	sa.forkRates.Add(forks)
+	sa.orphans = append(sa.orphans, orphanRate(ct, warmup))
+	sa.wasted = append(sa.wasted, wastedWorkFraction(ct, warmup))
+	if ct.txPerBlock > 0 {
+		confirmed, lost := throughput(ct, warmup)
+		sa.confirmedTx = append(sa.confirmedTx, confirmed)
+		sa.lostTx = append(sa.lostTx, lost)
+	}
+	sa.finality = append(sa.finality, averageFinalityDepth(ct, sa.ap.confidence, warmup))
+}
+
+// print prints the statistics gathered, along with those that need every
+// trial's chain if cts holds them.  Streamed suites, which keep no chains,
+// pass nil and leave those out.
+func (sa *suiteAnalysis) print(cts []*ChainTracker) {
+	confidence := sa.ap.confidence
+	avgFinality, _ := meanAndVariance(sa.finality)
+	avgRateVar, _ := meanAndVariance(sa.rateVars)
+	if w := sa.ap.warmup; w > 0 {
+		reportf("leaving out the first %d heights (warmup)\n", w)
+	}
+	printSummary("average live forks per round", sa.forks)
+	printQuantiles("live forks per round", sa.forkRates)
+	printSummary("average orphan rate", sa.orphans)
+	printSummary("average wasted work fraction", sa.wasted)
+	if len(sa.confirmedTx) > 0 {
+		printSummary(fmt.Sprintf("average throughput (transactions per round, %d per block)", sa.txPerBlock), sa.confirmedTx)
+		printSummary("average transactions per round lost to orphaned blocks", sa.lostTx)
+	}
+	printSummary("average blocks per round", sa.rateMeans)
+	reportf("average within-trial variance of blocks per round: %f\n", avgRateVar)
+	printSummary("average weight growth per round", sa.growth)
+	printSummary("average chain quality", sa.quality)
+	printSummary(fmt.Sprintf("average time to first fork (%d of %d trials forked)", len(sa.firstForks), sa.trials), sa.firstForks)
+	lmin, lmed, lmax, lp95 := lifetimeSummary(sa.lifetimes)
+	reportf("fork lifetimes (%d forks): min %d, median %d, p95 %d, max %d\n", len(sa.lifetimes), lmin, lmed, lp95, lmax)
+	reportf("maximum sustained split: %d rounds\n", sa.maxSplit)
+	if len(sa.gaps) > 0 {
+		printSummary(fmt.Sprintf("average weight gap between the two heaviest tipsets of forked heights (%d of %d trials forked)", len(sa.gaps), sa.trials), sa.gaps)
+	}
+	printSummary("average reorgs per trial", sa.reorgs)
+	if len(sa.disagreements) > 0 {
+		printSummary("average rounds where GHOST and heaviest tipset disagree on the head", sa.disagreements)
+	}
+	reportf("maximum reorg depth: %d blocks\n", sa.maxReorg)
+	printHistogram("live blocks per height (heights):", sa.hist)
+	printHistogram("blocks per canonical tipset (tipsets):", sa.sizes)
+	printSummary("average stall rate", sa.stalls)
+	printSummary("average longest null block run", sa.nullRuns)
+	printHistogram("longest null block run (trials):", sa.nullHist)
+	reportf("slashable equivocations: %d\n", sa.slashings)
+	if sa.slashings > 0 && cts != nil {
+		printSlashingTradeoff(cts)
+	}
+	printSummary(fmt.Sprintf("average finality depth (confidence %d)", confidence), sa.finality)
+	if bt := sa.blockTime; bt > 0 {
+		reportf("average finality time: %s\n", time.Duration(avgFinality*float64(bt)).Round(time.Second))
+	}
+	if cts != nil {
+		printFinalityPercentiles(cts, confidence, sa.ap.warmup)
+		printReorgAttacks(cts)
+		printInclusionDelays(cts, sa.ap.warmup)
+		printPrivateForkStats(cts)
+		printBootstrapDelays(cts)
+		printTopologyStats(cts)
+		printEarningsRatios(cts)
+	}
+	printSummary("average Nakamoto coefficient of the canonical chain", sa.nakamoto)
+	if len(sa.giniMeans) > 0 {
+		printSummary(fmt.Sprintf("average Gini coefficient of canonical block ownership (window %d)", sa.ap.giniWindow), sa.giniMeans)
+		printSummary("average Gini coefficient trend per height", sa.giniTrends)
+	}
+	if cts != nil {
+		printFairness(cts)
+	}
+}
@@ -0,0 +1,112 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// forkRateChains returns a chain of a single height holding n live blocks
+// for each n, so that averageLiveForksPerRound is n
+func forkRateChains(forks ...int) []*ChainTracker {
+	cts := make([]*ChainTracker, len(forks))
+	for i, n := range forks {
+		ct := NewChainTracker(nil)
+		ct.maxHeight = 0
+		ct.liveBlocksByHeight[0] = make([]*Block, n)
+		cts[i] = ct
+	}
+	return cts
+}
+
+func TestTrialsForCIWidth(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		forks []int
+		width float64
+		want  int
+	}{
+		// variance 2: n = ceil((2 * 1.96 * sqrt(2) / width)^2)
+		{"wide", []int{1, 3}, 2, 8},
+		{"narrow", []int{1, 3}, 1, 31},
+		{"narrower", []int{1, 3}, 0.5, 123},
+		// variance 1/3 over four trials
+		{"more trials", []int{1, 1, 2, 2}, 0.5, 21},
+		// too few for a sample variance, or none to spread
+		{"single trial", []int{4}, 1, 2},
+		{"no variance", []int{2, 2, 2}, 0.1, 2},
+		{"tiny variance", []int{1, 3}, 100, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := trialsForCIWidth(forkRateChains(tc.forks...), tc.width, 0); err != nil {
+				t.Error(err)
+			} else if got != tc.want {
+				t.Errorf("trialsForCIWidth(%v, %g) = %d, want %d", tc.forks, tc.width, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTrialsForCIWidthRejectsNonPositiveWidth(t *testing.T) {
+	for _, width := range []float64{0, -1} {
+		if _, err := trialsForCIWidth(forkRateChains(1, 3), width, 0); err == nil {
+			t.Errorf("trialsForCIWidth with width %g returned no error", width)
+		}
+	}
+}
+
+func TestBlockRateStatsMatchesPowers(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		miners   int
+		powers   string
+		election electionRule
+	}{
+		{"uniform", 10, "", linearElection},
+		{"skewed", 3, "0.5,0.3,0.2", linearElection},
+		{"zipf", 20, "zipf", linearElection},
+		{"poisson", 10, "", poissonElection},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(t, tc.miners, 1000, 1)
+			var err error
+			if cfg.powers, _, err = minerPowers(tc.miners, tc.powers, false); err != nil {
+				t.Fatal(err)
+			}
+			cfg.honestFrac = 1
+			cfg.election = tc.election
+			// tickets are hashes of lookback tickets, which with lbp 1
+			// and honest miners cycle within a few hundred rounds in the
+			// default ticket space
+			cfg.ticketSpace = 1 << 40
+
+			// every honest miner mines once per round, winning with
+			// probability its power, or at least once under Poisson
+			want := 0.0
+			for _, p := range cfg.powers {
+				if tc.election == poissonElection {
+					p = 1 - math.Exp(-p)
+				}
+				want += p
+			}
+			// pooled over a few trials
+			const trials = 5
+			var mean, variance float64
+			for seed := int64(0); seed < trials; seed++ {
+				ct, err := runSim(cfg, seed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m, v := blockRateStats(ct)
+				mean += m / trials
+				variance += v / trials
+			}
+			// five standard errors of the mean
+			if tol := 5 * math.Sqrt(variance/float64(trials*cfg.rounds)); math.Abs(mean-want) > tol {
+				t.Errorf("mean blocks per round %f, want %f within %f", mean, want, tol)
+			}
+			if variance <= 0 || variance > want {
+				t.Errorf("variance of blocks per round %f, want in (0, %f]", variance, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package sim
+
+import (
+	"math/rand"
+	"sort"
+)
+
+//**** Balance Attacker
+
+// BalanceAttacker tries to split the honest miners' power by keeping the two
+// heaviest forks at equal weight.  It considers every fork a RationalMiner
+// would, but of its winning blocks publishes the one leaving the smallest
+// weight gap between the two heaviest forks, rather than the heaviest.
+type BalanceAttacker struct {
+	*RationalMiner
+	Attack string `json:"attack"`
+}
+
+func NewBalanceAttacker(id int, power float64, totalMiners int, ticketSpace uint64, rng *rand.Rand) *BalanceAttacker {
+	rm := NewRationalMiner(id, power, totalMiners, ticketSpace, rng)
+	rm.Adversary = true
+	return &BalanceAttacker{
+		RationalMiner: rm,
+		Attack:        "balance",
+	}
+}
+
+// Mine outputs the winning block that best balances the two heaviest forks,
+// or nil if the attacker won on none of its forks.
+func (m *BalanceAttacker) Mine(ct *ChainTracker, atsforks [][]*Tipset) *Block {
+	m.ConsiderAllForks(atsforks)
+	tips := competingTips(m.PrivateForks)
+
+	var nullBlocks []*Block
+	var bestBlock *Block
+	bestGap := 0
+	for _, name := range forkNames(m.PrivateForks) {
+		blk := m.generateBlock(ct, m.PrivateForks[name])
+		if blk.Null {
+			nullBlocks = append(nullBlocks, blk)
+			continue
+		}
+		gap := ct.splitGap(tips, blk)
+		if bestBlock == nil || gap < bestGap || (gap == bestGap && blk.ParentWeight > bestBlock.ParentWeight) {
+			bestBlock = blk
+			bestGap = gap
+		}
+	}
+	ct.logf(logMiners, "balance attacker %d. number of priv forks: %d\n", m.MinerID, len(m.PrivateForks))
+
+	if bestBlock != nil {
+		m.PrivateForks = make(map[string]*Tipset)
+		return bestBlock
+	}
+	for _, nblk := range nullBlocks {
+		ct.allBlocks[nblk.Nonce] = nblk
+		delete(m.PrivateForks, nblk.Parents.Name)
+		nullTipset := ct.NewTipset([]*Block{nblk})
+		m.PrivateForks[nullTipset.Name] = nullTipset
+	}
+	return nil
+}
+
+//**** Reorg Attacker
+
+// ReorgAttacker tries to rewrite the last Depth blocks of the canonical chain,
+// as in a 51% attack.  Since blocks can only be mined at the current height,
+// reorg attackers fork a private chain off the head and mine on it alone,
+// withholding their blocks, until the public chain has built Depth blocks
+// past the fork.  All of a chain's reorg attackers mine the same private
+// chain, see reorgPool, so that they attack with their combined power.
+type ReorgAttacker struct {
+	*RationalMiner
+	Attack string `json:"attack"`
+	Depth  int    `json:"depth"`
+}
+
+func NewReorgAttacker(id int, power float64, totalMiners int, ticketSpace uint64, rng *rand.Rand, depth int) *ReorgAttacker {
+	rm := NewRationalMiner(id, power, totalMiners, ticketSpace, rng)
+	rm.Adversary = true
+	return &ReorgAttacker{
+		RationalMiner: rm,
+		Attack:        "reorg",
+		Depth:         depth,
+	}
+}
+
+// ReorgAttack records one attempt of the reorg attackers to rewrite the chain
+type ReorgAttack struct {
+	// attacker whose view of the head the private chain was forked off
+	Miner int
+	// height of the head the private chain was forked off
+	Start int
+	// height of the blocks the private chain was published with, and the
+	// nonce of one of them, or -1 if it never was
+	Release int
+	Tip     int
+}
+
+// reorgPool is the private chain all of a chain's reorg attackers mine.  Each
+// round every attacker mines atop its tip and the pool adds the round's
+// winning blocks to it as one tipset, or the first attacker's null block if
+// none won.  Once the round's tipset brings the private chain above the
+// heaviest head the attackers see, the pool publishes the whole private
+// chain along with it, rolling back the public blocks, and forks off the
+// head again.
+type reorgPool struct {
+	// tip of the private chain, nil until the next fork
+	fork *Tipset
+	// head the private chain was forked off
+	forkPoint *Tipset
+	// the private chain's blocks, null or not, oldest first
+	withheld []*Block
+	// depth attacked, that of the attacker that forked the chain
+	depth int
+	// index of the current attack in ct.reorgAttacks
+	attack int
+
+	// winning blocks mined atop fork this round, the first null one, and
+	// the heaviest head the attackers saw
+	mined []*Block
+	null  *Block
+	head  *Tipset
+}
+
+// Mine adds a block atop the private chain to the round's, forking the chain
+// off the head first if the last attack was published.  It outputs nil: the
+// pool publishes the private chain, if at all, once every attacker has mined,
+// see reorgPool.endRound.
+func (m *ReorgAttacker) Mine(ct *ChainTracker, atsforks [][]*Tipset) *Block {
+	if ct.reorgPool == nil {
+		ct.reorgPool = &reorgPool{}
+	}
+	p := ct.reorgPool
+	head := ct.headFor(m.MinerID)
+	if p.fork == nil {
+		p.fork, p.forkPoint, p.withheld, p.depth = head, head, nil, m.Depth
+		p.attack = len(ct.reorgAttacks)
+		ct.reorgAttacks = append(ct.reorgAttacks, ReorgAttack{Miner: m.MinerID, Start: head.getHeight(), Release: -1, Tip: -1})
+	}
+	if p.head == nil || head.Weight > p.head.Weight {
+		p.head = head
+	}
+
+	blk := m.generateBlock(ct, p.fork)
+	switch {
+	case !blk.Null:
+		p.mined = append(p.mined, blk)
+	case p.null == nil:
+		p.null = blk
+	}
+	return nil
+}
+
+// Bootstrap leaves the pool's attack to go on: the miner joins it when it
+// next mines
+func (m *ReorgAttacker) Bootstrap(head *Tipset) {}
+
+// endRound extends the private chain with the blocks the attackers mined this
+// round and returns them if they are published, along with the withheld
+// blocks they are mined atop.  If no attacker mined this round, as when all
+// have left the network, the attack is given up.
+func (p *reorgPool) endRound(ct *ChainTracker) []*Block {
+	if p == nil || p.fork == nil {
+		return nil
+	}
+	mined, null, head := p.mined, p.null, p.head
+	p.mined, p.null, p.head = nil, nil, nil
+	switch {
+	case null == nil && len(mined) == 0:
+		p.fork = nil
+		return nil
+	case len(mined) == 0:
+		p.fork = ct.NewTipset([]*Block{null})
+		p.withheld = append(p.withheld, null)
+		return nil
+	}
+
+	mined = ct.capTipset(mined)
+	p.fork = ct.NewTipset(mined)
+	height := p.fork.getHeight()
+	if blocksAbove(head, p.forkPoint.getHeight()) < p.depth || p.fork.Weight <= head.Weight {
+		ct.logf(logMiners, "reorg attackers. withholding %d blocks at height %d\n", len(mined), height)
+		p.withheld = append(p.withheld, mined...)
+		return nil
+	}
+
+	ct.logf(logMiners, "reorg attackers. publishing %d withheld blocks with %d at height %d\n", len(p.withheld), len(mined), height)
+	ct.publishLate(p.withheld)
+	ct.reorgAttacks[p.attack].Release = height
+	ct.reorgAttacks[p.attack].Tip = mined[0].Nonce
+	p.fork = nil
+	return mined
+}
+
+// blocksAbove returns the number of non-null blocks in the ancestry of ts
+// above the given height
+func blocksAbove(ts *Tipset, height int) int {
+	n := 0
+	for ; ts != nil && ts.getHeight() > height; ts = ts.getParents() {
+		if !ts.Blocks[0].Null {
+			n += len(ts.Blocks)
+		}
+	}
+	return n
+}
+
+// publishLate adds blocks mined in past rounds but withheld until now to the
+// chain at their heights, oldest first, so that a block published atop them
+// can be followed back to genesis.  Null blocks are only tracked for that.
+func (ct *ChainTracker) publishLate(blocks []*Block) {
+	for _, blk := range blocks {
+		ct.allBlocks[blk.Nonce] = blk
+		if blk.Null {
+			continue
+		}
+		ct.liveBlocksByHeight[blk.Height] = append(ct.liveBlocksByHeight[blk.Height], blk)
+		if ct.ghost != nil {
+			ct.ghost.add(blk)
+		}
+	}
+}
+
+// reorgAttackOutcomes returns the number of reorg attacks started in the
+// chain, and the duration in rounds of those that rewrote it: that were
+// published and ended up in the canonical chain.
+func reorgAttackOutcomes(ct *ChainTracker) (attempts int, durations []float64) {
+	canonical := headAncestry(ct)
+	for _, a := range ct.reorgAttacks {
+		if a.Release >= 0 && canonical[a.Tip] {
+			durations = append(durations, float64(a.Release-a.Start))
+		}
+	}
+	return len(ct.reorgAttacks), durations
+}
+
+// printReorgAttacks reports how often reorg attacks rewrote the chain over
+// all trials and how long the successful ones took, along with the depth
+// attacked and the attackers' combined share of power.  Attacks still
+// withheld at the end of a trial count as failures.
+func printReorgAttacks(cts []*ChainTracker) {
+	attempts := 0
+	var durations []float64
+	for _, ct := range cts {
+		a, d := reorgAttackOutcomes(ct)
+		attempts += a
+		durations = append(durations, d...)
+	}
+	if attempts == 0 {
+		return
+	}
+
+	depth := 0
+	var power float64
+	for _, m := range cts[0].miners {
+		if ra, ok := m.(*ReorgAttacker); ok {
+			depth = ra.Depth
+			power += ra.Power()
+		}
+	}
+	reportf("reorg attacks (depth %d, attacker power %f): %d of %d attempts rewrote the chain (%f)\n",
+		depth, power, len(durations), attempts, float64(len(durations))/float64(attempts))
+	if len(durations) > 0 {
+		printSummary("average rounds to rewrite the chain", durations)
+	}
+}
+
+// competingTips returns the live tipsets the given forks are mined atop,
+// keeping only the largest tipset for each set of parents so that subsets of
+// a tipset don't count as forks of their own.
+func competingTips(forks map[string]*Tipset) []*Tipset {
+	largest := make(map[tipsetKey]*Tipset)
+	for _, ts := range forks {
+		live := ts
+		if ts.Blocks[0].Null {
+			live = ts.Blocks[0].liveParents()
+		}
+		key := tipsetKey{parents: parentName(live.Blocks[0]), height: live.getHeight()}
+		if cur, ok := largest[key]; !ok || len(live.Blocks) > len(cur.Blocks) {
+			largest[key] = live
+		}
+	}
+
+	tips := make([]*Tipset, 0, len(largest))
+	for _, ts := range largest {
+		tips = append(tips, ts)
+	}
+	return tips
+}
+
+// splitGap returns the weight gap between the two heaviest forks of the chain
+// if blk were published on top of tips.  The block's live parent stops being a tip of
+// its own.
+func (ct *ChainTracker) splitGap(tips []*Tipset, blk *Block) int {
+	parent := blk.liveParents()
+	weights := []int{ct.weight(blk.ParentWeight, blk.weight())}
+	for _, ts := range tips {
+		if ts.Name != parent.Name {
+			weights = append(weights, ts.Weight)
+		}
+	}
+	if len(weights) == 1 {
+		return weights[0]
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(weights)))
+	return weights[0] - weights[1]
+}
+
+// weightGaps returns, for each height past the warmup with more than one
+// live tipset, the weight the heaviest tipset mined at that height leads the
+// second heaviest by.  Small gaps leave the network close to a tie and open
+// to reorgs.
+func weightGaps(ct *ChainTracker, warmup int) []int {
+	var gaps []int
+	for h := ct.firstMeasured(warmup); h <= ct.maxHeight; h++ {
+		tipsets := ct.allTipsets(ct.liveBlocksByHeight[h])
+		if len(tipsets) < 2 {
+			continue
+		}
+		sort.Slice(tipsets, func(i, j int) bool { return tipsets[i].Weight > tipsets[j].Weight })
+		gaps = append(gaps, tipsets[0].Weight-tipsets[1].Weight)
+	}
+	return gaps
+}
+
+// avgWeightGap returns the mean of weightGaps, or 0 if no height had more
+// than one live tipset
+func avgWeightGap(ct *ChainTracker, warmup int) float64 {
+	gaps := weightGaps(ct, warmup)
+	if len(gaps) == 0 {
+		return 0
+	}
+	total := 0
+	for _, g := range gaps {
+		total += g
+	}
+	return float64(total) / float64(len(gaps))
+}
+
+// longestSplit returns the longest run of consecutive heights at which the
+// two heaviest tipsets mined at that height, on different parents, had equal
+// weight, i.e. how long the network stayed evenly split.
+func longestSplit(ct *ChainTracker) int {
+	longest, run := 0, 0
+	for h := 1; h <= ct.maxHeight; h++ {
+		tipsets := ct.allTipsets(ct.liveBlocksByHeight[h])
+		sort.Slice(tipsets, func(i, j int) bool { return tipsets[i].Weight > tipsets[j].Weight })
+		if len(tipsets) >= 2 && tipsets[0].Weight == tipsets[1].Weight {
+			run++
+		} else {
+			run = 0
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
@@ -0,0 +1,72 @@
+package sim
+
+import (
+	"fmt"
+	"testing"
+)
+
+// miner counts and lookbacks benchmarked by BenchmarkRunSingleSim
+var (
+	benchMiners = []int{10, 50, 100}
+	benchLBPs   = []int{1, 150}
+	// blocks per round given to allTipsets
+	benchTipsetBlocks = []int{100, 1000}
+)
+
+// benchSeed seeds every benchmarked trial so runs are comparable
+const benchSeed = 1
+
+// benchRounds is the number of rounds of every benchmarked trial
+const benchRounds = 100
+
+// BenchmarkRunSingleSim times a single trial for every combination of
+// benchMiners and benchLBPs, e.g. go test -bench RunSingleSim -benchmem
+func BenchmarkRunSingleSim(b *testing.B) {
+	for _, miners := range benchMiners {
+		for _, lbp := range benchLBPs {
+			b.Run(fmt.Sprintf("miners=%d/lbp=%d", miners, lbp), func(b *testing.B) {
+				cfg := testConfig(b, miners, benchRounds, lbp)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := runSim(cfg, benchSeed); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkAllTipsets(b *testing.B) {
+	for _, n := range benchTipsetBlocks {
+		b.Run(fmt.Sprintf("blocks=%d", n), func(b *testing.B) {
+			ct := NewChainTracker(nil)
+			blocks := benchBlocks(ct, n)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ct.allTipsets(blocks)
+			}
+		})
+	}
+}
+
+// benchBlocks returns n blocks at height 1 mined by distinct miners atop a
+// handful of competing parents, as delivered in a round with n winners.
+func benchBlocks(ct *ChainTracker, n int) []*Block {
+	parents := make([]*Tipset, 4)
+	for i := range parents {
+		parents[i] = ct.NewTipset([]*Block{{Nonce: i, Owner: i, Seed: uint64(i)}})
+	}
+	blocks := make([]*Block, n)
+	for i := range blocks {
+		blocks[i] = &Block{
+			Nonce:        len(parents) + i,
+			Parents:      parents[i%len(parents)],
+			Owner:        i,
+			Height:       1,
+			ParentWeight: 1,
+			Seed:         uint64((i * 7919) % n),
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,201 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// churnEvent has a miner join or leave the network from a round onwards
+type churnEvent struct {
+	minerID int
+	round   int
+	join    bool
+}
+
+// ChurnSchedule lists miners joining and leaving the network, sorted by
+// round.  Miners whose first event is a join are inactive until then.
+// Inactive miners don't mine, and bootstrap from the network's head when
+// they join; whenever the set changes, the active miners share the power of
+// the whole network in proportion to their base powers.
+type ChurnSchedule []churnEvent
+
+// parseChurn parses a spec of the form "miner3@join100,miner5@leave200"
+func parseChurn(spec string) (ChurnSchedule, error) {
+	var cs ChurnSchedule
+	for _, entry := range strings.Split(spec, ",") {
+		kv := strings.Split(entry, "@")
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "miner") {
+			return nil, fmt.Errorf("churn entry %q must be of the form minerX@joinY or minerX@leaveY", entry)
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(kv[0], "miner"))
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid miner %q", kv[0])
+		}
+
+		ev := churnEvent{minerID: id}
+		var round string
+		switch {
+		case strings.HasPrefix(kv[1], "join"):
+			ev.join = true
+			round = strings.TrimPrefix(kv[1], "join")
+		case strings.HasPrefix(kv[1], "leave"):
+			round = strings.TrimPrefix(kv[1], "leave")
+		default:
+			return nil, fmt.Errorf("churn entry %q must join or leave", entry)
+		}
+		if ev.round, err = strconv.Atoi(round); err != nil || ev.round < 0 {
+			return nil, fmt.Errorf("invalid round %q", round)
+		}
+		cs = append(cs, ev)
+	}
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].round < cs[j].round })
+	return cs, nil
+}
+
+// validate checks that every event refers to one of totalMiners miners
+func (cs ChurnSchedule) validate(totalMiners int) error {
+	for _, ev := range cs {
+		if ev.minerID >= totalMiners {
+			return fmt.Errorf("miner %d does not exist, there are %d miners", ev.minerID, totalMiners)
+		}
+	}
+	return nil
+}
+
+// activeAt returns which of the miners are active in the given round
+func (cs ChurnSchedule) activeAt(miners []Miner, round int) map[int]bool {
+	active := make(map[int]bool, len(miners))
+	for _, m := range miners {
+		active[m.ID()] = true
+	}
+	seen := make(map[int]bool)
+	for _, ev := range cs {
+		if !seen[ev.minerID] {
+			seen[ev.minerID] = true
+			active[ev.minerID] = !ev.join
+		}
+	}
+	for _, ev := range cs {
+		if ev.round <= round {
+			active[ev.minerID] = ev.join
+		}
+	}
+	return active
+}
+
+// changesAt returns whether any miner joins or leaves in the given round
+func (cs ChurnSchedule) changesAt(round int) bool {
+	for _, ev := range cs {
+		if ev.round == round {
+			return true
+		}
+	}
+	return false
+}
+
+// renormalizePowers gives each active miner its share of basePowers among
+// the active miners and inactive miners no power, logging the result.
+func renormalizePowers(ct *ChainTracker, miners []Miner, basePowers []float64, active map[int]bool, round int) {
+	// the network's total power is kept, e.g. a shard's share of it
+	var total, all float64
+	for _, m := range miners {
+		all += basePowers[m.ID()]
+		if active[m.ID()] {
+			total += basePowers[m.ID()]
+		}
+	}
+
+	ct.logf(logRounds, "round %d: renormalizing power among active miners\n", round)
+	for _, m := range miners {
+		rm := rationalMiner(m)
+		rm.MinerPower = 0
+		if active[m.ID()] && total > 0 {
+			rm.MinerPower = basePowers[m.ID()] * all / total
+		}
+		ct.logf(logMiners, "\tminer %d: active %t, power %f\n", m.ID(), active[m.ID()], rm.MinerPower)
+	}
+}
+
+// BootstrapEvent records a miner joining the network in Round
+type BootstrapEvent struct {
+	Miner int
+	Round int
+}
+
+// rejoin brings a miner joining in round up to date: rather than mining on
+// from where it left off, or from genesis, it bootstraps from the network's
+// head, extended with null blocks up to the round's height so it mines at the
+// same height as everyone else.
+func rejoin(ct *ChainTracker, m Miner, round int) {
+	rm := rationalMiner(m)
+	ct.views[rm.MinerID] = ct.head
+	m.Bootstrap(rm.catchUp(ct, ct.head, round))
+	ct.bootstraps = append(ct.bootstraps, BootstrapEvent{Miner: rm.MinerID, Round: round})
+}
+
+// bootstrapDelays returns, for every miner joining the network, the number of
+// rounds until it mined a block of the canonical chain, or -1 if it never did
+// before leaving again or the end of the chain.
+func bootstrapDelays(ct *ChainTracker) []int {
+	ancestry := headAncestry(ct)
+	delays := make([]int, 0, len(ct.bootstraps))
+	for i, ev := range ct.bootstraps {
+		// count until the miner's next join, which follows a leave
+		until := ct.maxHeight + 1
+		for _, next := range ct.bootstraps[i+1:] {
+			if next.Miner == ev.Miner {
+				until = next.Round
+				break
+			}
+		}
+		first := -1
+		for nonce := range ancestry {
+			blk := ct.allBlocks[nonce]
+			// blocks mined in a round are at the next height
+			mined := blk.Height - 1
+			if blk.Owner != ev.Miner || mined < ev.Round || mined >= until {
+				continue
+			}
+			if first < 0 || mined < first {
+				first = mined
+			}
+		}
+		if first >= 0 {
+			first -= ev.Round
+		}
+		delays = append(delays, first)
+	}
+	return delays
+}
+
+// printBootstrapDelays reports how long miners joining the network took to
+// contribute to the canonical chain, over all trials.
+func printBootstrapDelays(cts []*ChainTracker) {
+	var delays []float64
+	joins := 0
+	for _, ct := range cts {
+		for _, d := range bootstrapDelays(ct) {
+			joins++
+			if d >= 0 {
+				delays = append(delays, float64(d))
+			}
+		}
+	}
+	if joins == 0 {
+		return
+	}
+	printSummary(fmt.Sprintf("average rounds for a joining miner to reach the canonical chain (%d of %d joins did)", len(delays), joins), delays)
+}
+
+// catchUp extends ts with the miner's null blocks until it reaches height
+func (m *RationalMiner) catchUp(ct *ChainTracker, ts *Tipset, height int) *Tipset {
+	for ts.getHeight() < height {
+		// the miner was away, so it ran no election for these
+		blk := m.nullBlock(ct, ts)
+		ct.allBlocks[blk.Nonce] = blk
+		ts = ct.NewTipset([]*Block{blk})
+	}
+	return ts
+}
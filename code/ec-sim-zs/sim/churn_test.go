@@ -0,0 +1,45 @@
+package sim
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCatchUpBuildsNullBlocks(t *testing.T) {
+	ct, err := buildScenario(reorgScenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts := fmt.Sprint(ct.attempts)
+	m := rationalMiner(ct.miners[1])
+	from := ct.head
+	to := from.getHeight() + 3
+
+	ts := m.catchUp(ct, from, to)
+	if ts.getHeight() != to {
+		t.Fatalf("caught up to height %d, want %d", ts.getHeight(), to)
+	}
+	for h := to; h > from.getHeight(); h-- {
+		blk := ts.Blocks[0]
+		if len(ts.Blocks) != 1 || !blk.Null || blk.WinCount != 0 || blk.Owner != m.MinerID || blk.Height != h {
+			t.Errorf("%s at height %d isn't a null block of m%d", ts.Name, h, m.MinerID)
+		}
+		if blk.ParentWeight != from.Weight {
+			t.Errorf("null block at height %d has parent weight %d, want %d", h, blk.ParentWeight, from.Weight)
+		}
+		if want := m.generateTicket(ts.getParents().MinTicket); blk.Seed != want {
+			t.Errorf("null block at height %d has ticket %d, want %d", h, blk.Seed, want)
+		}
+		if ct.allBlocks[blk.Nonce] != blk {
+			t.Errorf("null block at height %d isn't tracked", h)
+		}
+		ts = ts.getParents()
+	}
+	if ts != from {
+		t.Errorf("catch-up starts from %s, want %s", ts.Name, from.Name)
+	}
+	// the miner ran no elections while it was away
+	if got := fmt.Sprint(ct.attempts); got != attempts {
+		t.Errorf("attempts %s, want %s", got, attempts)
+	}
+}
@@ -0,0 +1,745 @@
+package sim
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+//**** Subcommands
+//
+//	run      simulate trials (the flags of the legacy command line)
+//	sweep    run the parameter sweep described by -config
+//	draw     redraw chains saved with -json
+//	analyze  print suite metrics over chains saved with -json
+//
+// Without a subcommand every mode is selected by flags, as before.
+
+const usage = `usage: ec-sim-zs [run|sweep|draw|analyze|validate] [flags] [chain.json ...]
+
+Without a subcommand, flags select the mode (see -h).
+`
+
+// Main runs the ec-sim-zs command line on args, the arguments following the
+// program name.  It exits the process on invalid arguments or failed runs.
+func Main(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			runCmd(args[1:])
+			return
+		case "sweep":
+			sweepCmd(args[1:])
+			return
+		case "draw":
+			drawCmd(args[1:])
+			return
+		case "analyze":
+			analyzeCmd(args[1:])
+			return
+		case "validate":
+			validateCmd(args[1:])
+			return
+		}
+	}
+
+	// legacy command line: flags select the mode
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	sf := defineSimFlags(flag.CommandLine)
+	fLoad := flag.String("load", "", "redraw a chain previously written with -json instead of simulating")
+	fConfig := flag.String("config", "", "run the parameter sweep described by this JSON config file")
+	fValidate := flag.String("validate", "", "check a chain previously written with -json against the consensus rules instead of simulating")
+	fDiff := flag.String("diff", "", "compare two chains previously written with -json, e.g. a.json,b.json")
+	fResume := flag.String("resume", "", "continue a chain previously written with -json for -rounds more rounds")
+
+	flag.CommandLine.Parse(args)
+	sf.parsed(flag.CommandLine)
+
+	if *fLoad != "" {
+		checkFormat(*sf.format)
+		ct, err := loadChain(*fLoad)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load chain: %s\n", err)
+			os.Exit(1)
+		}
+		name := strings.TrimSuffix(filepath.Base(*fLoad), ".json")
+		renderChain(ct, name, ".", *sf.format)
+		return
+	}
+
+	if *fValidate != "" {
+		if !validateFile(*fValidate) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *fDiff != "" {
+		paths := strings.Split(*fDiff, ",")
+		if len(paths) != 2 {
+			fmt.Fprintf(os.Stderr, "invalid -diff %q: must be two comma-separated paths\n", *fDiff)
+			os.Exit(1)
+		}
+		cts := loadChains(paths)
+		reportf("a: %s\nb: %s\n", paths[0], paths[1])
+		reportf("%s", diffChains(cts[0], cts[1]))
+		return
+	}
+
+	if *fConfig != "" {
+		sf.runSweepConfig(*fConfig)
+		return
+	}
+
+	cfg := sf.config()
+	stop := sf.start(cfg)
+	defer stop()
+
+	if *fResume != "" {
+		ct, err := loadChain(*fResume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load chain: %s\n", err)
+			os.Exit(1)
+		}
+		var seed int64
+		if seedFor := sf.seedFor(); seedFor != nil {
+			seed = seedFor(0)
+		} else if seed, err = newSeed(); err != nil {
+			fmt.Fprintf(os.Stderr, "resuming failed: %s\n", err)
+			os.Exit(1)
+		}
+		roundNum := *sf.rounds
+		if err := resumeSim(*cfg, ct, roundNum, seed); err != nil {
+			fmt.Fprintf(os.Stderr, "resuming failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		chainName := fmt.Sprintf("%s-resumed-rds=%d", strings.TrimSuffix(filepath.Base(*fResume), ".json"), roundNum)
+		if *sf.json {
+			writeChain(ct, chainName, *sf.output)
+		}
+		renderChain(ct, chainName, ".", *sf.format)
+		return
+	}
+
+	sf.runSuite(cfg)
+}
+
+// simFlags holds the flags configuring simulations, shared by the legacy
+// command line and the run and sweep subcommands
+type simFlags struct {
+	lbp           *int
+	rounds        *int
+	lbpSchedule   *string
+	miners        *int
+	trials        *int
+	output        *string
+	honest        *float64
+	powers        *string
+	hashRate      *bool
+	seed          *int64
+	partition     *string
+	topology      *string
+	linkDelay     *int
+	format        *string
+	frames        *string
+	overlay       *bool
+	stream        *bool
+	json          *bool
+	canonical     *bool
+	stats         *string
+	confidence    *int
+	ticketSpace   *int64
+	adversary     *float64
+	qualityWindow *int
+	giniWindow    *int
+	blockReward   *float64
+	txPerBlock    *int
+	quiet         *bool
+	ciWidth       *float64
+	blockTime     *time.Duration
+	tieBreak      *string
+	forkChoice    *string
+	disagreements *bool
+	prune         *int
+	difficulty    *string
+	genesisSeed   *int64
+	shards        *int
+	shardSplit    *string
+	attack        *string
+	reorgDepth    *int
+	mix           *string
+	maxForks      *int
+	risk          *float64
+	slashPenalty  *float64
+	warmup        *int
+	churn         *string
+	events        *string
+	strict        *bool
+	election      *string
+	script        *string
+	cpuprofile    *string
+	verbosity     *int
+	logFormat     *string
+	weight        *string
+	maxTipsetSize *int
+
+	// whether -seed and -genesisSeed were explicitly passed
+	seeded        bool
+	genesisSeeded bool
+	// whether runs log nothing unless -v is passed, see quietByDefault
+	quietDefault bool
+}
+
+func defineSimFlags(fs *flag.FlagSet) *simFlags {
+	return &simFlags{
+		lbp:           fs.Int("lbp", 1, "sim lookback"),
+		rounds:        fs.Int("rounds", 100, "number of rounds to sim"),
+		lbpSchedule:   fs.String("lbpSchedule", "", "lookback changes over the run, e.g. 1@0,30@100,100@200 (overrides -lbp)"),
+		miners:        fs.Int("miners", 10, "number of miners to sim"),
+		trials:        fs.Int("trials", 1, "number of trials to run"),
+		output:        fs.String("output", ".", "output folder"),
+		honest:        fs.Float64("honest", 0, "fraction of miners following the honest strategy"),
+		powers:        fs.String("powers", "", "miner powers: comma-separated list summing to 1, or zipf/pareto (default uniform)"),
+		hashRate:      fs.Bool("hashrate", false, "read -powers as absolute hash rates, e.g. 100,50,50, normalized to fractions of network power"),
+		seed:          fs.Int64("seed", 0, "base RNG seed; trial n is seeded with seed+n (default random)"),
+		partition:     fs.String("partition", "", "partition miners during a range of rounds, e.g. A:0-4,B:5-9@round50-100"),
+		topology:      fs.String("topology", "", "network topology delaying blocks between miners by -linkDelay rounds per link: ring, star (around miner 0) or random:P (random geometric graph linking miners closer than P in the unit square)"),
+		linkDelay:     fs.Int("linkDelay", 1, "rounds a block takes to cross each link of -topology"),
+		format:        defineFormatFlag(fs),
+		frames:        fs.String("frames", "", "in single trials, draw the chain as of every round to this folder as frame_000.dot, frame_001.dot, ..."),
+		overlay:       fs.Bool("overlay", false, "in suites, draw how often each number of live blocks per height occurred and followed another across trials, as name.overlay.dot (or .svg with -format=svg)"),
+		stream:        fs.Bool("stream", false, "in suites, analyze each trial as soon as the trials before it have been, in trial order, and drop its chain, so that memory stays bounded however many trials run; leaves out -overlay, -ciWidth and the reports that need every chain"),
+		json:          fs.Bool("json", false, "write each trial's chain as JSON to the output folder"),
+		canonical:     fs.Bool("canonical", false, "write each trial's canonical chain as a JSON list of tipsets, genesis first, to the output folder"),
+		stats:         fs.String("stats", "", "if set, write per-trial statistics to this CSV file"),
+		confidence:    defineConfidenceFlag(fs),
+		ticketSpace:   fs.Int64("ticketSpace", bigOlNum, "size of the ticket space tickets are drawn from"),
+		adversary:     fs.Float64("adversary", 0, "fraction of miners, taken from the highest IDs, tagged as adversaries for chain quality"),
+		qualityWindow: defineQualityWindowFlag(fs),
+		giniWindow:    defineGiniWindowFlag(fs),
+		blockReward:   fs.Float64("blockReward", 1, "reward paid for each block in the canonical chain"),
+		txPerBlock:    fs.Int("txPerBlock", 0, "transactions carried by each block, for reporting throughput and capacity lost to orphans (default not reported)"),
+		quiet:         fs.Bool("quiet", false, "don't report progress during suite runs"),
+		ciWidth:       fs.Float64("ciWidth", 0, "if set, estimate trials needed for a fork-rate CI of this width"),
+		blockTime:     fs.Duration("blockTime", 30*time.Second, "duration of a round, used to timestamp blocks"),
+		tieBreak:      fs.String("tiebreak", "minTicket", "fork choice tiebreaker between tipsets of equal weight: minTicket, cardinality, distinctMiners, name, power (most miner power) or powerCoin (coin weighted by miner power)"),
+		forkChoice:    fs.String("forkchoice", "heaviest", "fork choice rule: heaviest (heaviest tipset) or ghost (subtree with the most blocks)"),
+		disagreements: fs.Bool("disagreements", false, "count rounds in which GHOST and heaviest tipset would pick different heads, keeping GHOST's block tree under -forkchoice=heaviest too"),
+		prune:         fs.Int("prune", 0, "every this many rounds, drop blocks more than this many heights below the head and forks not built on the head's ancestor there (default keep everything)"),
+		shards:        fs.Int("shards", 1, "number of independent chains every miner splits its power across"),
+		shardSplit:    fs.String("shardSplit", "", "fraction of every miner's power given to each shard, e.g. 0.7,0.3 (default equal)"),
+		genesisSeed:   fs.Int64("genesisSeed", 0, "seed for the tickets of genesis and its ancestors (default drawn from each trial's seed)"),
+		difficulty:    fs.String("difficulty", "fixed", "winning threshold: fixed, or adaptive to target one block per round"),
+		maxForks:      fs.Int("maxForks", 0, "number of private forks rational miners mine on, heaviest first (default all)"),
+		risk:          fs.Float64("risk", 0, "probability a rational miner winning on several forks publishes all its winning blocks, equivocating"),
+		slashPenalty:  fs.Float64("slashPenalty", 0, "penalty paid for each slashable equivocation, deducted from the miner's rewards"),
+		warmup:        defineWarmupFlag(fs),
+		mix:           fs.String("mix", "", "relative weights of miner strategies, e.g. rational:6,honest:2,balance:1 or honest:9,reorg:1 (overrides -honest and -attack); strategies are honest, rational, balance and reorg, selfish mining is not supported"),
+		attack:        fs.String("attack", "", "strategy followed by the -adversary miners: balance or reorg (default none)"),
+		reorgDepth:    fs.Int("reorgDepth", 6, "number of canonical blocks reorg attackers try to rewrite"),
+		churn:         fs.String("churn", "", "miners joining and leaving over time, e.g. miner3@join100,miner5@leave200"),
+		events:        fs.String("events", "", "stream a JSON event per round to this file (- for stdout)"),
+		strict:        fs.Bool("strict", false, "validate tipset invariants whenever a tipset is built"),
+		election:      fs.String("election", "linear", "leader election: linear (win at most once) or poisson (win count drawn from Poisson(power))"),
+		script:        fs.String("script", "", "scripted election winners overriding tickets, e.g. 1:0+1+2,2:0,3: (round:miners; other rounds drawn as usual)"),
+		cpuprofile:    fs.String("cpuprofile", "", "write cpu profile to file"),
+		weight:        fs.String("weight", "additive", "tipset weight function: additive (+1 per block), discount (+ceil(log2(n+1))) or log (+256*log2(n+1), scale -confidence to match)"),
+		maxTipsetSize: fs.Int("maxTipsetSize", 0, "maximum blocks in a tipset; extra blocks sharing parents are orphaned, highest tickets first (0 for no limit)"),
+		logFormat:     fs.String("logFormat", "text", "format of the -v log written to stderr: text or json (one JSON object per line)"),
+		verbosity:     fs.Int("v", -1, "verbosity: 0 silent, 1 round summaries, 2 per-miner fork counts, 3 every block (default 3 for a single trial, 0 for suites)"),
+	}
+}
+
+func defineFormatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", "dot", "graph output format: dot, svg (requires GraphViz), tipsets (dot with blocks boxed by tipset), gexf (for Gephi), mermaid, or filecoin (canonical chain as Filecoin tipset JSON)")
+}
+
+func defineConfidenceFlag(fs *flag.FlagSet) *int {
+	return fs.Int("confidence", 3, "weight lead over competing forks at which a height is considered final")
+}
+
+func defineQualityWindowFlag(fs *flag.FlagSet) *int {
+	return fs.Int("qualityWindow", 0, "number of most recent heights chain quality is measured over (default whole chain)")
+}
+
+func defineGiniWindowFlag(fs *flag.FlagSet) *int {
+	return fs.Int("giniWindow", 50, "number of heights in each window the Gini coefficient of canonical block ownership is measured over")
+}
+
+func defineWarmupFlag(fs *flag.FlagSet) *int {
+	return fs.Int("warmup", 0, "leave the first this many heights out of fork, orphan, wasted work, weight growth and finality metrics")
+}
+
+// checkWarmup validates the -warmup flag
+func checkWarmup(warmup int) {
+	if warmup < 0 {
+		fmt.Fprintf(os.Stderr, "invalid -warmup %d: must not be negative\n", warmup)
+		os.Exit(1)
+	}
+}
+
+// checkFormat validates the -format flag
+func checkFormat(format string) {
+	switch format {
+	case "dot", "svg", "tipsets", "gexf", "mermaid", "filecoin":
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -format %q: must be dot, svg, tipsets, gexf, mermaid or filecoin\n", format)
+		os.Exit(1)
+	}
+}
+
+// parsed records which flags of fs were explicitly passed; call after fs.Parse
+func (sf *simFlags) parsed(fs *flag.FlagSet) {
+	switch *sf.logFormat {
+	case "text":
+	case "json":
+		SetLogJSON(true)
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -logFormat %q: must be text or json\n", *sf.logFormat)
+		os.Exit(1)
+	}
+	// only seed deterministically if the flag was explicitly passed
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "seed":
+			sf.seeded = true
+		case "genesisSeed":
+			sf.genesisSeeded = true
+		}
+	})
+}
+
+// quietByDefault silences runs of many trials, such as sweeps, unless -v
+// was given
+func (sf *simFlags) quietByDefault() {
+	sf.quietDefault = true
+}
+
+// verbosityLevel returns the level -v selects, by default every block for a
+// single trial and nothing for suites
+func (sf *simFlags) verbosityLevel() int {
+	if *sf.verbosity >= 0 {
+		return *sf.verbosity
+	}
+	if *sf.trials == 1 && !sf.quietDefault {
+		return logBlocks
+	}
+	return 0
+}
+
+// seedFor returns the seed of each trial, or nil for random seeds
+func (sf *simFlags) seedFor() func(n int) int64 {
+	if !sf.seeded {
+		return nil
+	}
+	return func(n int) int64 { return *sf.seed + int64(n) }
+}
+
+// analysisParams returns the parameters of suite metrics
+func (sf *simFlags) analysisParams() *analysisParams {
+	return &analysisParams{
+		confidence:    *sf.confidence,
+		qualityWindow: *sf.qualityWindow,
+		giniWindow:    *sf.giniWindow,
+		warmup:        *sf.warmup,
+	}
+}
+
+// toConfig returns the simulation config the flags select
+func (sf *simFlags) toConfig() Config {
+	c := Config{
+		Miners:        *sf.miners,
+		Rounds:        *sf.rounds,
+		LBP:           *sf.lbp,
+		LBPSchedule:   *sf.lbpSchedule,
+		Trials:        *sf.trials,
+		Honest:        *sf.honest,
+		Powers:        *sf.powers,
+		HashRate:      *sf.hashRate,
+		Partition:     *sf.partition,
+		Topology:      *sf.topology,
+		LinkDelay:     *sf.linkDelay,
+		TicketSpace:   *sf.ticketSpace,
+		Adversary:     *sf.adversary,
+		BlockReward:   *sf.blockReward,
+		TxPerBlock:    *sf.txPerBlock,
+		BlockTime:     *sf.blockTime,
+		TieBreak:      *sf.tieBreak,
+		ForkChoice:    *sf.forkChoice,
+		Disagreements: *sf.disagreements,
+		Weight:        *sf.weight,
+		MaxTipsetSize: *sf.maxTipsetSize,
+		Prune:         *sf.prune,
+		Difficulty:    *sf.difficulty,
+		Election:      *sf.election,
+		Script:        *sf.script,
+		Attack:        *sf.attack,
+		ReorgDepth:    *sf.reorgDepth,
+		MaxForks:      *sf.maxForks,
+		Risk:          *sf.risk,
+		SlashPenalty:  *sf.slashPenalty,
+		Mix:           *sf.mix,
+		Churn:         *sf.churn,
+		Verbosity:     sf.verbosityLevel(),
+		Strict:        *sf.strict,
+	}
+	if sf.seeded {
+		c.Seed = sf.seed
+	}
+	if sf.genesisSeeded {
+		c.GenesisSeed = sf.genesisSeed
+	}
+	return c
+}
+
+// config validates the flags and builds the simulation config, exiting on
+// invalid flags.
+func (sf *simFlags) config() *simConfig {
+	checkFormat(*sf.format)
+	checkWarmup(*sf.warmup)
+
+	cfg, err := sf.toConfig().build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *sf.ticketSpace < 100*int64(*sf.miners) {
+		fmt.Fprintf(os.Stderr, "warning: ticket space %d is small for %d miners, win probabilities will be coarsely quantized\n", *sf.ticketSpace, *sf.miners)
+	}
+	return cfg
+}
+
+// start opens the event stream and starts CPU profiling if requested.  The
+// returned function stops both.
+func (sf *simFlags) start(cfg *simConfig) func() {
+	if *sf.events != "" {
+		var err error
+		cfg.events, err = newEventWriter(*sf.events)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -events: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	profiling := false
+	if *sf.cpuprofile != "" {
+		f, err := os.Create(*sf.cpuprofile)
+		if err != nil {
+			panic(err)
+		}
+		pprof.StartCPUProfile(f)
+		profiling = true
+	}
+
+	return func() {
+		if profiling {
+			pprof.StopCPUProfile()
+		}
+		cfg.events.close()
+	}
+}
+
+// runSuite runs the configured trials, writes their output and prints the
+// suite's metrics.
+func (sf *simFlags) runSuite(cfg *simConfig) {
+	roundNum, lbp, totalMiners := *sf.rounds, *sf.lbp, *sf.miners
+	outputDir := *sf.output
+
+	if *sf.shards > 1 {
+		split, err := parseShardSplit(*sf.shardSplit, *sf.shards)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -shardSplit: %s\n", err)
+			os.Exit(1)
+		}
+		if err := runShards(cfg, split, *sf.trials, sf.seedFor(), *sf.quiet, *sf.warmup); err != nil {
+			fmt.Fprintf(os.Stderr, "simulation failed: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.hashRates != nil {
+		printHashRates(cfg.hashRates, cfg.powers)
+	}
+
+	suite := *sf.trials > 1
+	stream := suite && *sf.stream
+	if suite && *sf.frames != "" {
+		fmt.Fprintln(os.Stderr, "warning: -frames is only drawn for single trials")
+	}
+	if !suite && *sf.overlay {
+		fmt.Fprintln(os.Stderr, "warning: -overlay is only drawn for suites")
+	}
+	if stream && (*sf.overlay || *sf.ciWidth > 0) {
+		fmt.Fprintln(os.Stderr, "warning: -overlay and -ciWidth need every trial's chain and are left out with -stream")
+	}
+
+	// report writes a trial's output as it is handed over, in trial order
+	ap := sf.analysisParams()
+	sa := newSuiteAnalysis(ap)
+	var stats *statsWriter
+	var peakHeap, prunedHeap uint64
+	report := func(i int, result *ChainTracker) {
+		if result.peakHeap > peakHeap {
+			peakHeap, prunedHeap = result.peakHeap, result.prunedHeap
+		}
+
+		if cfg.partitions != nil {
+			reportHeadAgreement(result)
+			printHeadAgreement(result, cfg.partitions)
+		}
+		chainName := fmt.Sprintf("rds=%d-lbp=%d-mins=%d-ts=%d-%d", roundNum, lbp, totalMiners, time.Now().Unix(), i+1)
+
+		// create output folder if it doesn't exist
+		if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+			os.Mkdir(outputDir, 0700)
+		}
+
+		// capture chain for future use
+		if *sf.json {
+			writeChain(result, chainName, outputDir)
+		}
+		if *sf.canonical {
+			writeCanonicalChain(result, filepath.Join(outputDir, chainName+".canonical.json"))
+		}
+
+		// if single trial, draw output
+		if !suite {
+			renderChain(result, chainName, ".", *sf.format)
+			if *sf.frames != "" {
+				writeFrames(result, *sf.frames)
+			}
+			printHistogram("live blocks per height (heights):", forkHistogram(result, ap.warmup))
+			printHistogram("blocks per canonical tipset (tipsets):", tipsetSizeDistribution(result, ap.warmup))
+			run, round := longestNullRun(result)
+			reportf("longest null block run: %d (round %d)\n", run, round)
+			single := []*ChainTracker{result}
+			printInclusionDelays(single, ap.warmup)
+			printFairness(single)
+			printBootstrapDelays(single)
+			printReorgAttacks(single)
+		}
+		if stream {
+			if stats != nil {
+				stats.write(i, result)
+			}
+			sa.add(result)
+		}
+	}
+
+	if stream {
+		// only the chains of the trials running or waiting on an earlier
+		// one are held
+		if *sf.stats != "" {
+			stats = newStatsWriter(*sf.stats, ap.warmup)
+		}
+		if err := streamTrials(cfg, *sf.trials, sf.seedFor(), *sf.quiet, runtime.GOMAXPROCS(0), report); err != nil {
+			fmt.Fprintf(os.Stderr, "simulation failed: %s\n", err)
+			os.Exit(1)
+		}
+		if stats != nil {
+			stats.close()
+		}
+		sa.print(nil)
+		printPeakHeap(cfg, peakHeap, prunedHeap)
+		return
+	}
+
+	cts, err := runTrials(cfg, *sf.trials, sf.seedFor(), *sf.quiet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulation failed: %s\n", err)
+		os.Exit(1)
+	}
+	for i, result := range cts {
+		report(i, result)
+	}
+
+	if *sf.stats != "" {
+		writeStats(cts, *sf.stats, ap.warmup)
+	}
+
+	if suite && *sf.overlay {
+		name := fmt.Sprintf("rds=%d-lbp=%d-mins=%d-ts=%d", roundNum, lbp, totalMiners, time.Now().Unix())
+		renderForkOverlay(cts, ap.warmup, name, outputDir, *sf.format)
+	}
+
+	if suite {
+		for _, ct := range cts {
+			sa.add(ct)
+		}
+		sa.print(cts)
+		if *sf.ciWidth > 0 {
+			n, err := trialsForCIWidth(cts, *sf.ciWidth, ap.warmup)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid -ciWidth: %s\n", err)
+				os.Exit(1)
+			}
+			reportf("trials needed for CI width %f: %d\n", *sf.ciWidth, n)
+		}
+	}
+	printPeakHeap(cfg, peakHeap, prunedHeap)
+}
+
+// printPeakHeap reports the most heap in use just before pruning, which
+// -prune bounds, over every trial, and the heap left by the prune after it
+func printPeakHeap(cfg *simConfig, peakHeap, prunedHeap uint64) {
+	if cfg.prune > 0 {
+		reportf("peak heap in use while pruning: %.1f MiB before pruning, %.1f MiB after\n", float64(peakHeap)/(1<<20), float64(prunedHeap)/(1<<20))
+	}
+}
+
+// runSweepConfig runs the sweep described by the config file at path.  The
+// flags that depend on the number of miners, such as -powers, are checked
+// against each miner count of the sweep by runSweep.
+func (sf *simFlags) runSweepConfig(path string) {
+	checkFormat(*sf.format)
+	checkWarmup(*sf.warmup)
+	sc, err := loadSweepConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -config: %s\n", err)
+		os.Exit(1)
+	}
+	sf.quietByDefault()
+
+	// holds the event stream every combination writes to
+	var shared simConfig
+	stop := sf.start(&shared)
+	defer stop()
+	if err := runSweep(sc, sf.toConfig(), shared.events, sf.seedFor(), *sf.quiet, sf.analysisParams()); err != nil {
+		fmt.Fprintf(os.Stderr, "sweep failed: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// runCmd implements the run subcommand
+func runCmd(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	sf := defineSimFlags(fs)
+	fs.Parse(args)
+	sf.parsed(fs)
+
+	cfg := sf.config()
+	stop := sf.start(cfg)
+	defer stop()
+	sf.runSuite(cfg)
+}
+
+// sweepCmd implements the sweep subcommand
+func sweepCmd(args []string) {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	sf := defineSimFlags(fs)
+	fConfig := fs.String("config", "", "JSON config file describing the sweep (required)")
+	fs.Parse(args)
+	sf.parsed(fs)
+	if *fConfig == "" {
+		fmt.Fprintln(os.Stderr, "sweep: -config is required")
+		os.Exit(1)
+	}
+
+	sf.runSweepConfig(*fConfig)
+}
+
+// loadChains loads the chains at paths, exiting if any can't be loaded
+func loadChains(paths []string) []*ChainTracker {
+	cts := make([]*ChainTracker, 0, len(paths))
+	for _, path := range paths {
+		ct, err := loadChain(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load chain %s: %s\n", path, err)
+			os.Exit(1)
+		}
+		cts = append(cts, ct)
+	}
+	return cts
+}
+
+// drawCmd implements the draw subcommand, redrawing each saved chain
+func drawCmd(args []string) {
+	fs := flag.NewFlagSet("draw", flag.ExitOnError)
+	fFormat := defineFormatFlag(fs)
+	fOutput := fs.String("output", ".", "output folder")
+	fs.Parse(args)
+	checkFormat(*fFormat)
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "draw: no chains given")
+		os.Exit(1)
+	}
+
+	for i, ct := range loadChains(fs.Args()) {
+		name := strings.TrimSuffix(filepath.Base(fs.Arg(i)), ".json")
+		renderChain(ct, name, *fOutput, *fFormat)
+	}
+}
+
+// validateCmd implements the validate subcommand, checking each saved chain
+// against the consensus rules
+func validateCmd(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "validate: no chains given")
+		os.Exit(1)
+	}
+
+	valid := true
+	for _, path := range fs.Args() {
+		if !validateFile(path) {
+			valid = false
+		}
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+// validateFile loads the chain at path and prints every violation of the
+// consensus rules validateChain finds, reporting whether there were none
+func validateFile(path string) bool {
+	ct, err := loadChain(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load chain: %s\n", err)
+		return false
+	}
+	errs := validateChain(ct)
+	for _, err := range errs {
+		reportln(err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%s breaks the consensus rules %d times\n", path, len(errs))
+		return false
+	}
+	reportf("%s is valid\n", path)
+	return true
+}
+
+// analyzeCmd implements the analyze subcommand, printing suite metrics over
+// the saved chains
+func analyzeCmd(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	fConfidence := defineConfidenceFlag(fs)
+	fQualityWindow := defineQualityWindowFlag(fs)
+	fGiniWindow := defineGiniWindowFlag(fs)
+	fWarmup := defineWarmupFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "analyze: no chains given")
+		os.Exit(1)
+	}
+	checkWarmup(*fWarmup)
+
+	analyzeSim(loadChains(fs.Args()), &analysisParams{
+		confidence:    *fConfidence,
+		qualityWindow: *fQualityWindow,
+		giniWindow:    *fGiniWindow,
+		warmup:        *fWarmup,
+	})
+}
@@ -0,0 +1,114 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// blockKey identifies a block across chains.  Nonces are only unique within
+// a run, but a block mined by the same miner at the same height with the
+// same ticket is the same block.
+type blockKey struct {
+	owner  int
+	height int
+	seed   uint64
+}
+
+func keyOf(blk *Block) blockKey {
+	return blockKey{owner: blk.Owner, height: blk.Height, seed: blk.Seed}
+}
+
+// ChainDiff summarizes the structural differences between two chains
+type ChainDiff struct {
+	// first height at which the canonical chains differ, -1 if they never do
+	DivergenceHeight int
+	// non-null blocks found in only one of the chains
+	UniqueToA, UniqueToB int
+	// head weight of a minus head weight of b
+	WeightDiff int
+}
+
+// canonicalByHeight returns the keys of the canonical chain's non-null blocks
+// at each height, sorted.
+func canonicalByHeight(ct *ChainTracker) map[int][]blockKey {
+	byHeight := make(map[int][]blockKey)
+	for nonce := range headAncestry(ct) {
+		blk := ct.allBlocks[nonce]
+		byHeight[blk.Height] = append(byHeight[blk.Height], keyOf(blk))
+	}
+	for _, keys := range byHeight {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].seed < keys[j].seed })
+	}
+	return byHeight
+}
+
+func equalKeys(a, b []blockKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// liveBlockKeys returns the keys of every non-null block mined in ct
+func liveBlockKeys(ct *ChainTracker) map[blockKey]bool {
+	keys := make(map[blockKey]bool)
+	for _, blocks := range ct.liveBlocksByHeight {
+		for _, blk := range blocks {
+			keys[keyOf(blk)] = true
+		}
+	}
+	return keys
+}
+
+// diffChains compares the canonical chains and mined blocks of a and b
+func diffChains(a, b *ChainTracker) ChainDiff {
+	d := ChainDiff{
+		DivergenceHeight: -1,
+		WeightDiff:       a.head.Weight - b.head.Weight,
+	}
+
+	canonA, canonB := canonicalByHeight(a), canonicalByHeight(b)
+	maxHeight := a.maxHeight
+	if b.maxHeight > maxHeight {
+		maxHeight = b.maxHeight
+	}
+	for h := 0; h <= maxHeight; h++ {
+		if !equalKeys(canonA[h], canonB[h]) {
+			d.DivergenceHeight = h
+			break
+		}
+	}
+
+	keysA, keysB := liveBlockKeys(a), liveBlockKeys(b)
+	for k := range keysA {
+		if !keysB[k] {
+			d.UniqueToA++
+		}
+	}
+	for k := range keysB {
+		if !keysA[k] {
+			d.UniqueToB++
+		}
+	}
+	return d
+}
+
+// String returns a human readable summary of the diff
+func (d ChainDiff) String() string {
+	b := new(strings.Builder)
+	if d.DivergenceHeight < 0 {
+		fmt.Fprintln(b, "canonical chains agree at every height")
+	} else {
+		fmt.Fprintf(b, "canonical chains diverge at height %d\n", d.DivergenceHeight)
+	}
+	fmt.Fprintf(b, "blocks only in a: %d\n", d.UniqueToA)
+	fmt.Fprintf(b, "blocks only in b: %d\n", d.UniqueToB)
+	fmt.Fprintf(b, "head weight difference (a - b): %d\n", d.WeightDiff)
+	return b.String()
+}
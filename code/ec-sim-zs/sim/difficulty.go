@@ -0,0 +1,70 @@
+package sim
+
+import "fmt"
+
+// difficultyRule decides how the winning threshold changes over time
+type difficultyRule int
+
+const (
+	// fixedDifficulty never changes the threshold
+	fixedDifficulty difficultyRule = iota
+	// adaptiveDifficulty rescales the threshold every difficultyWindow
+	// rounds to target difficultyTarget non-null blocks per round
+	adaptiveDifficulty
+)
+
+const (
+	// rounds over which the block rate is observed before each adjustment
+	difficultyWindow = 20
+	// non-null blocks per round adaptive difficulty aims for
+	difficultyTarget = 1.0
+	// largest factor a single adjustment may scale the threshold by
+	maxDifficultyStep = 2.0
+)
+
+// parseDifficulty parses the -difficulty flag
+func parseDifficulty(s string) (difficultyRule, error) {
+	switch s {
+	case "", "fixed":
+		return fixedDifficulty, nil
+	case "adaptive":
+		return adaptiveDifficulty, nil
+	}
+	return 0, fmt.Errorf("unknown difficulty %q: must be fixed or adaptive", s)
+}
+
+func (d difficultyRule) String() string {
+	if d == adaptiveDifficulty {
+		return "adaptive"
+	}
+	return "fixed"
+}
+
+// adjustDifficulty records the threshold scale used in the round just mined
+// and, under the adaptive rule, rescales it at the end of every window so
+// that the window's block rate would have hit the target.  A single step is
+// bounded by maxDifficultyStep either way so a window of bad luck can't
+// swing it too far.
+func (ct *ChainTracker) adjustDifficulty(rule difficultyRule) {
+	ct.difficulties = append(ct.difficulties, ct.difficulty)
+	n := len(ct.blocksPerRound)
+	if rule != adaptiveDifficulty || n == 0 || n%difficultyWindow != 0 {
+		return
+	}
+
+	total := 0
+	for _, b := range ct.blocksPerRound[n-difficultyWindow:] {
+		total += b
+	}
+	rate := float64(total) / difficultyWindow
+	step := maxDifficultyStep
+	if rate > 0 {
+		step = difficultyTarget / rate
+	}
+	if step > maxDifficultyStep {
+		step = maxDifficultyStep
+	} else if step < 1/maxDifficultyStep {
+		step = 1 / maxDifficultyStep
+	}
+	ct.difficulty *= step
+}
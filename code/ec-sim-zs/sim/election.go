@@ -0,0 +1,123 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// electionRule decides how many times an election proof wins
+type electionRule int
+
+const (
+	// linearElection wins once when the ticket falls within the miner's
+	// share of the ticket space
+	linearElection electionRule = iota
+	// poissonElection draws the win count from a Poisson distribution whose
+	// mean is the miner's power
+	poissonElection
+)
+
+// parseElection parses the -election flag
+func parseElection(s string) (electionRule, error) {
+	switch s {
+	case "", "linear":
+		return linearElection, nil
+	case "poisson":
+		return poissonElection, nil
+	}
+	return 0, fmt.Errorf("unknown election %q: must be linear or poisson", s)
+}
+
+func (e electionRule) String() string {
+	if e == poissonElection {
+		return "poisson"
+	}
+	return "linear"
+}
+
+// ElectionOracle scripts election outcomes in place of the ticket draw, so
+// that exact fork situations can be built.  Wins returns how many times miner
+// wins at height, or false to leave it to the miner's ticket.
+type ElectionOracle interface {
+	Wins(miner, height int) (int, bool)
+}
+
+// ScriptedElection is an ElectionOracle reading from a table of the miners
+// winning at each scripted height, i.e. the blocks delivered in each scripted
+// round.  Every other miner loses at those heights; heights left out of the
+// table are drawn as usual.
+type ScriptedElection map[int]map[int]int
+
+// parseScriptedElection parses the -script flag: comma separated entries
+// round:miners, the miners winning that round joined by "+", e.g.
+// 1:0+1+2,2:0,3: has miners 0, 1 and 2 win round 1, miner 0 alone win round 2
+// and nobody win round 3.  A miner listed twice wins twice.
+func parseScriptedElection(s string, totalMiners int) (ScriptedElection, error) {
+	script := make(ScriptedElection)
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("entry %q must be of the form round:miners", entry)
+		}
+		round, err := strconv.Atoi(parts[0])
+		if err != nil || round < 1 {
+			return nil, fmt.Errorf("invalid round %q: must be a positive integer", parts[0])
+		}
+		if _, ok := script[round]; ok {
+			return nil, fmt.Errorf("round %d scripted twice", round)
+		}
+		script[round] = make(map[int]int)
+		if parts[1] == "" {
+			continue
+		}
+		for _, f := range strings.Split(parts[1], "+") {
+			id, err := strconv.Atoi(f)
+			if err != nil || id < 0 || id >= totalMiners {
+				return nil, fmt.Errorf("invalid miner %q in round %d: must be between 0 and %d", f, round, totalMiners-1)
+			}
+			script[round][id]++
+		}
+	}
+	return script, nil
+}
+
+// Wins returns how many times miner wins at height if the height is scripted
+func (s ScriptedElection) Wins(miner, height int) (int, bool) {
+	winners, ok := s[height]
+	if !ok {
+		return 0, false
+	}
+	return winners[miner], true
+}
+
+// electionWins returns how many times ticket wins for a miner with the given
+// power.  Under the linear rule this is 0 or 1 as in isWinningTicket.  Under
+// the Poisson rule the ticket, scaled to [0, 1), is inverted through the CDF
+// of a Poisson distribution with mean power, so a miner can win several
+// times in a round and the network still expects one win per round.
+//
+// The simulator keeps its null block abstraction: a block is null when it
+// wins 0 times.  A miner winning more than once still publishes a single
+// block, since two blocks in a round would be slashable, and that block
+// counts once per win towards its tipset's weight.
+func electionWins(rule electionRule, ticket uint64, power float64, ticketSpace uint64) int {
+	if rule == linearElection {
+		if isWinningTicket(ticket, power, ticketSpace) {
+			return 1
+		}
+		return 0
+	}
+
+	u := float64(ticket) / float64(ticketSpace)
+	p := math.Exp(-power)
+	cdf := p
+	wins := 0
+	for u >= cdf && p > 0 {
+		wins++
+		p *= power / float64(wins)
+		cdf += p
+	}
+	return wins
+}
@@ -0,0 +1,78 @@
+package sim
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// roundEvent is written by emitEvent at the start of every round
+type roundEvent struct {
+	// seed of the trial, telling apart events of concurrent trials
+	Seed   int64  `json:"seed"`
+	Round  int    `json:"round"`
+	Blocks []int  `json:"blocks"`
+	Owners []int  `json:"owners"`
+	Head   string `json:"head"`
+	// weight of the head tipset
+	HeadWeight int `json:"headWeight"`
+	// number of tipsets the round's blocks form
+	LiveForks int `json:"liveForks"`
+}
+
+// eventWriter streams newline-delimited JSON events, one per line, shared by
+// all trials of a run
+type eventWriter struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+// newEventWriter writes events to path, or to stdout if path is "-"
+func newEventWriter(path string) (*eventWriter, error) {
+	var w io.WriteCloser = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &eventWriter{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// emitEvent writes the event for a round whose delivered blocks are blocks.
+// A nil writer discards events.
+func (ew *eventWriter) emitEvent(ct *ChainTracker, seed int64, round int, blocks []*Block) {
+	if ew == nil {
+		return
+	}
+	ev := roundEvent{
+		Seed:       seed,
+		Round:      round,
+		Blocks:     make([]int, len(blocks)),
+		Owners:     make([]int, len(blocks)),
+		Head:       ct.head.Name,
+		HeadWeight: ct.head.Weight,
+		LiveForks:  len(ct.allTipsets(blocks)),
+	}
+	for i, blk := range blocks {
+		ev.Blocks[i] = blk.Nonce
+		ev.Owners[i] = blk.Owner
+	}
+
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	if err := ew.enc.Encode(ev); err != nil {
+		panic(err)
+	}
+}
+
+// close closes the underlying file, leaving stdout open
+func (ew *eventWriter) close() error {
+	if ew == nil || ew.w == os.Stdout {
+		return nil
+	}
+	return ew.w.Close()
+}
@@ -0,0 +1,108 @@
+package sim
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// The types below mirror the JSON of Filecoin tipsets as returned by Lotus'
+// ChainGetTipSet, keeping the fields the simulator has a counterpart for.
+// Block nonces stand in for CIDs.
+
+type filecoinCid struct {
+	Root string `json:"/"`
+}
+
+type filecoinTicket struct {
+	VRFProof []byte
+}
+
+type filecoinElectionProof struct {
+	WinCount int
+}
+
+type filecoinBlock struct {
+	Miner         string
+	Ticket        filecoinTicket
+	ElectionProof *filecoinElectionProof `json:",omitempty"`
+	Parents       []filecoinCid
+	ParentWeight  string
+	Height        int
+	Timestamp     uint64
+}
+
+type filecoinTipset struct {
+	Cids   []filecoinCid
+	Blocks []filecoinBlock
+	Height int
+}
+
+// filecoinAddress returns a pseudo ID address for a miner: f00 for genesis
+// and f01000 onwards for miners, as actor IDs are allocated on Filecoin
+func filecoinAddress(owner int) string {
+	if owner == -1 {
+		return "f00"
+	}
+	return fmt.Sprintf("f0%d", 1000+owner)
+}
+
+func filecoinCids(ts *Tipset) []filecoinCid {
+	cids := make([]filecoinCid, len(ts.Blocks))
+	for i, blk := range ts.Blocks {
+		cids[i] = filecoinCid{Root: strconv.Itoa(blk.Nonce)}
+	}
+	return cids
+}
+
+// writeFilecoinFormat outputs the canonical chain, from genesis to the head,
+// as an array of Filecoin style tipsets.  Null tipsets are left out, so as on
+// Filecoin null rounds show up as gaps in height.
+func writeFilecoinFormat(ct *ChainTracker, path string) {
+	reportf("Writing Filecoin tipsets %s\n", path)
+
+	var tipsets []filecoinTipset
+	for ts := ct.head; ; ts = ts.getParents() {
+		if !ts.Blocks[0].Null {
+			fts := filecoinTipset{Cids: filecoinCids(ts), Height: ts.getHeight()}
+			for _, blk := range ts.Blocks {
+				fb := filecoinBlock{
+					Miner:        filecoinAddress(blk.Owner),
+					Parents:      []filecoinCid{},
+					ParentWeight: strconv.Itoa(blk.ParentWeight),
+					Height:       blk.Height,
+					Timestamp:    uint64(blk.Timestamp.Seconds()),
+				}
+				fb.Ticket.VRFProof = make([]byte, 8)
+				binary.BigEndian.PutUint64(fb.Ticket.VRFProof, blk.Seed)
+				// genesis has no parents and wins no election, and the
+				// oldest blocks of a pruned chain were cut from theirs
+				if blk.Owner != -1 {
+					if blk.Parents != nil {
+						fb.Parents = filecoinCids(blk.liveParents())
+					}
+					fb.ElectionProof = &filecoinElectionProof{WinCount: blk.weight()}
+				}
+				fts.Blocks = append(fts.Blocks, fb)
+			}
+			tipsets = append(tipsets, fts)
+		}
+		if ts.Blocks[0].Owner == -1 || ts.getParents() == nil {
+			break
+		}
+	}
+	// oldest first
+	for i, j := 0, len(tipsets)-1; i < j; i, j = i+1, j-1 {
+		tipsets[i], tipsets[j] = tipsets[j], tipsets[i]
+	}
+
+	marshalled, err := json.MarshalIndent(tipsets, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(path, marshalled, 0644); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,229 @@
+package sim
+
+import (
+	"sort"
+	"time"
+)
+
+// percentiles of finality depth reported by printFinalityPercentiles
+var finalityPercentileRanks = []int{50, 90, 99}
+
+// canonicalTipsets returns the tipsets of the head's ancestry down to genesis,
+// or as far as a pruned chain goes, null tipsets included, indexed by name.
+func canonicalTipsets(ct *ChainTracker) map[string]*Tipset {
+	canonical := make(map[string]*Tipset)
+	for ts := ct.head; ; ts = ts.getParents() {
+		canonical[ts.Name] = ts
+		if ts.Blocks[0].Owner == -1 || ts.getParents() == nil {
+			return canonical
+		}
+	}
+}
+
+// forkPoints returns, for every live tipset that can be formed from the
+// chain's blocks, the height at which its ancestry last meets the canonical
+// chain.  Canonical tipsets fork at their own height.
+func forkPoints(ct *ChainTracker, canonical map[string]*Tipset) map[*Tipset]int {
+	memo := make(map[string]int)
+	var forkPoint func(ts *Tipset) int
+	forkPoint = func(ts *Tipset) int {
+		if _, ok := canonical[ts.Name]; ok {
+			return ts.getHeight()
+		}
+		if fp, ok := memo[ts.Name]; ok {
+			return fp
+		}
+		fp := forkPoint(ts.getParents())
+		memo[ts.Name] = fp
+		return fp
+	}
+
+	points := make(map[*Tipset]int)
+	for h := 0; h <= ct.maxHeight; h++ {
+		for _, ts := range ct.allTipsets(ct.liveBlocksByHeight[h]) {
+			points[ts] = forkPoint(ts)
+		}
+	}
+	return points
+}
+
+// finalityDepth returns, for each height with a live canonical tipset, the
+// number of additional rounds until the canonical chain outweighs every fork
+// that doesn't contain that tipset by at least confidence.  A fork skipping
+// the tipset entirely, mined on its parents, always competes.  Heights that
+// never reach the threshold by the end of the run are left out.
+func finalityDepth(ct *ChainTracker, confidence int) map[int]int {
+	canonical := canonicalTipsets(ct)
+	points := forkPoints(ct, canonical)
+
+	// weight of the canonical chain and its live tipset at each height
+	canonWeight := weightGrowth(ct)
+	canonAt := make(map[int]*Tipset)
+	for _, ts := range canonical {
+		if !ts.Blocks[0].Null && ts.getHeight() <= ct.maxHeight {
+			canonAt[ts.getHeight()] = ts
+		}
+	}
+
+	depths := make(map[int]int)
+	for h, cts := range canonAt {
+		if cts.Blocks[0].Owner == -1 {
+			continue
+		}
+
+		// heaviest competitor at each height, among forks leaving the
+		// canonical chain below h
+		compAt := make([]int, ct.maxHeight+1)
+		for ts, fp := range points {
+			th := ts.getHeight()
+			if fp < h && th >= h && ts.Weight > compAt[th] {
+				compAt[th] = ts.Weight
+			}
+		}
+
+		competitor := cts.Blocks[0].ParentWeight
+		for d := 0; h+d <= ct.maxHeight; d++ {
+			if compAt[h+d] > competitor {
+				competitor = compAt[h+d]
+			}
+			if canonWeight[h+d]-competitor >= confidence {
+				depths[h] = d
+				break
+			}
+		}
+	}
+	return depths
+}
+
+// measuredFinalityDepths returns the finality depths of the heights the
+// per-height metrics look at that reached finality, sorted.
+func measuredFinalityDepths(ct *ChainTracker, confidence, warmup int) []int {
+	var depths []int
+	first := ct.firstMeasured(warmup)
+	for h, d := range finalityDepth(ct, confidence) {
+		if h >= first {
+			depths = append(depths, d)
+		}
+	}
+	sort.Ints(depths)
+	return depths
+}
+
+// averageFinalityDepth returns the mean finality depth over all heights past
+// the warmup that reached finality.
+func averageFinalityDepth(ct *ChainTracker, confidence, warmup int) float64 {
+	depths := measuredFinalityDepths(ct, confidence, warmup)
+	if len(depths) == 0 {
+		return 0
+	}
+	total := 0
+	for _, d := range depths {
+		total += d
+	}
+	return float64(total) / float64(len(depths))
+}
+
+// finalityPercentiles returns the p50, p90 and p99 finality depths, keyed by
+// percentile, over all heights past the warmup that reached finality: the
+// number of rounds a block waits to be final in the typical and worst cases.
+func finalityPercentiles(ct *ChainTracker, confidence, warmup int) map[int]int {
+	return depthPercentiles(measuredFinalityDepths(ct, confidence, warmup))
+}
+
+// depthPercentiles returns the finalityPercentileRanks of sorted depths
+func depthPercentiles(sorted []int) map[int]int {
+	ps := make(map[int]int, len(finalityPercentileRanks))
+	if len(sorted) == 0 {
+		return ps
+	}
+	for _, p := range finalityPercentileRanks {
+		ps[p] = percentile(sorted, float64(p))
+	}
+	return ps
+}
+
+// printFinalityPercentiles reports the finality depth percentiles over the
+// heights of all trials, and the corresponding times if rounds have one, for
+// picking a confirmation depth at the trials' lookback.
+func printFinalityPercentiles(cts []*ChainTracker, confidence, warmup int) {
+	var depths []int
+	for _, ct := range cts {
+		depths = append(depths, measuredFinalityDepths(ct, confidence, warmup)...)
+	}
+	sort.Ints(depths)
+	ps := depthPercentiles(depths)
+
+	reportf("finality depth percentiles (lbp %s, confidence %d, %d heights):", cts[0].lbps, confidence, len(depths))
+	for i, p := range finalityPercentileRanks {
+		if i > 0 {
+			reportf(",")
+		}
+		reportf(" p%d %d", p, ps[p])
+		if bt := cts[0].blockTime; bt > 0 {
+			reportf(" (%s)", time.Duration(ps[p])*bt)
+		}
+	}
+	reportln()
+}
+
+// inclusionDelays returns, for each block of the canonical chain past the
+// warmup, the number of rounds from its delivery until it first joined the
+// head's ancestry, sorted.  Blocks the head builds on straight away wait 0
+// rounds; blocks first left on a losing fork wait until the reorg bringing
+// them in, the time an apparent confirmation of the fork could be wrong.
+func inclusionDelays(ct *ChainTracker, warmup int) []int {
+	// round each block first joined the head's ancestry
+	included := make(map[int]int)
+	for _, snap := range ct.headTimeline {
+		blocks := blocksNamed(ct, snap.Head)
+		for len(blocks) > 0 {
+			// a tipset's blocks share parents, so once one of them is
+			// included all their ancestors already are
+			seen := false
+			for _, blk := range blocks {
+				if _, ok := included[blk.Nonce]; ok {
+					seen = true
+				} else {
+					included[blk.Nonce] = snap.Round
+				}
+			}
+			parents := blocks[0].Parents
+			if seen || parents == nil {
+				break
+			}
+			blocks = parents.Blocks
+		}
+	}
+
+	var delays []int
+	for nonce := range headAncestry(ct) {
+		blk := ct.allBlocks[nonce]
+		if blk.Owner == -1 || blk.Height < ct.firstMeasured(warmup) {
+			continue
+		}
+		if round, ok := included[nonce]; ok {
+			delays = append(delays, round-blk.Height)
+		}
+	}
+	sort.Ints(delays)
+	return delays
+}
+
+// printInclusionDelays reports the distribution of inclusion delays over the
+// canonical blocks of all trials past the warmup.
+func printInclusionDelays(cts []*ChainTracker, warmup int) {
+	hist := make(map[int]int)
+	total, n := 0, 0
+	for _, ct := range cts {
+		for _, d := range inclusionDelays(ct, warmup) {
+			hist[d]++
+			total += d
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	reportf("average inclusion delay: %f rounds (%d of %d canonical blocks delayed)\n", float64(total)/float64(n), n-hist[0], n)
+	printHistogram("inclusion delay of canonical blocks (blocks):", hist)
+}
@@ -0,0 +1,259 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+)
+
+// forkChoiceRule decides which tipset the network takes as its head
+type forkChoiceRule int
+
+const (
+	// heaviestTipsetChoice picks the heaviest tipset seen, see heaviestTipset
+	heaviestTipsetChoice forkChoiceRule = iota
+	// ghostChoice walks the block tree from genesis, following at each fork
+	// the subtree with the most live blocks, see ghostTipset
+	ghostChoice
+)
+
+// parseForkChoice parses the -forkchoice flag
+func parseForkChoice(s string) (forkChoiceRule, error) {
+	switch s {
+	case "", "heaviest":
+		return heaviestTipsetChoice, nil
+	case "ghost":
+		return ghostChoice, nil
+	}
+	return 0, fmt.Errorf("unknown fork choice %q: must be heaviest or ghost", s)
+}
+
+func (f forkChoiceRule) String() string {
+	if f == ghostChoice {
+		return "ghost"
+	}
+	return "heaviest"
+}
+
+// ghostTree is the block tree GHOST walks.  Each node holds the live blocks
+// sharing parents and height, i.e. the largest tipset they can form.  Null
+// blocks are skipped over: a block mined atop null blocks is a child of their
+// live ancestor.
+//
+// The tree keeps the path GHOST follows from its root to the head up to date
+// as blocks are added, so that a block only revisits the nodes between it and
+// the path.  Nodes off the path keep the size of their subtree; the size of a
+// node on it is the number of blocks in the tree less those hanging off the
+// path above it, summed by a Fenwick tree over path positions.
+type ghostTree struct {
+	// chain whose blocks the tree holds, which builds its tipsets
+	ct *ChainTracker
+	// tiebreaker between subtrees of equal size
+	prefer TieBreaker
+	nodes  map[tipsetKey]*ghostNode
+	root   *ghostNode
+	// nodes GHOST follows from the root to the head
+	path []*ghostNode
+	// blocks in each node of the path and in its children off the path
+	side fenwick
+	// live blocks in the tree
+	total int
+}
+
+type ghostNode struct {
+	blocks   []*Block
+	parent   *ghostNode
+	children []*ghostNode
+	// position on the GHOST path, -1 if off it
+	pos int
+	// live blocks in the node and all of its descendants, while off the path
+	size int
+	// tipset of blocks, built when first needed
+	ts *Tipset
+}
+
+func nodeKey(blk *Block) tipsetKey {
+	return tipsetKey{parents: parentName(blk), height: blk.Height}
+}
+
+// newGhostTree builds the block tree of every live block in ct
+func newGhostTree(ct *ChainTracker) *ghostTree {
+	g := &ghostTree{ct: ct, prefer: ct.tieBreaker, nodes: make(map[tipsetKey]*ghostNode)}
+	if g.prefer == nil {
+		g.prefer = minTicketTieBreaker
+	}
+	heights := make([]int, 0, len(ct.liveBlocksByHeight))
+	for h := range ct.liveBlocksByHeight {
+		heights = append(heights, h)
+	}
+	sort.Ints(heights)
+	for _, h := range heights {
+		for _, blk := range ct.liveBlocksByHeight[h] {
+			g.add(blk)
+		}
+	}
+	return g
+}
+
+// add inserts a live block into the tree and moves the GHOST path onto the
+// block's fork if it now has the larger subtree.  Its live parents must
+// already be in the tree, unless it is the first block added.
+func (g *ghostTree) add(blk *Block) {
+	k := nodeKey(blk)
+	n, ok := g.nodes[k]
+	if !ok {
+		n = &ghostNode{pos: -1}
+		g.nodes[k] = n
+		if g.root != nil {
+			n.parent = g.nodes[nodeKey(blk.liveParents().Blocks[0])]
+			if n.parent == nil {
+				panic(fmt.Sprintf("Check your assumptions: block %d added to the GHOST tree before its parents", blk.Nonce))
+			}
+			n.parent.children = append(n.parent.children, n)
+		}
+	}
+	n.blocks = append(n.blocks, blk)
+	n.ts = nil
+	g.total++
+
+	if g.root == nil {
+		// genesis, or the oldest block kept if pruned
+		g.root = n
+		n.pos = 0
+		g.path = []*ghostNode{n}
+		g.side.append(1)
+		return
+	}
+	if n.pos >= 0 {
+		// the path only grows stronger
+		g.side.add(n.pos, 1)
+		return
+	}
+
+	// grow the subtrees up to the path, and see whether the fork joining it
+	// now beats the path there
+	fork := n
+	for {
+		fork.size++
+		if fork.parent.pos >= 0 {
+			break
+		}
+		fork = fork.parent
+	}
+	at := fork.parent
+	g.side.add(at.pos, 1)
+	if at.pos+1 < len(g.path) {
+		if !g.better(fork, g.path[at.pos+1]) {
+			return
+		}
+		g.leavePath(at.pos + 1)
+	}
+	g.follow(fork)
+}
+
+// size returns the number of live blocks in the node and its descendants
+func (g *ghostTree) size(n *ghostNode) int {
+	if n.pos >= 0 {
+		return g.total - g.side.prefix(n.pos)
+	}
+	return n.size
+}
+
+// better reports whether GHOST prefers sibling a over b: the larger subtree,
+// or the tipset preferred by the tiebreaker if they are of equal size
+func (g *ghostTree) better(a, b *ghostNode) bool {
+	sa, sb := g.size(a), g.size(b)
+	return sa > sb || (sa == sb && g.prefer(g.tipset(a), g.tipset(b)))
+}
+
+// leavePath takes the nodes from position pos on off the path, counting them
+// among the blocks hanging off the node before
+func (g *ghostTree) leavePath(pos int) {
+	for i := len(g.path) - 1; i >= pos; i-- {
+		n := g.path[i]
+		n.size = g.size(n)
+		n.pos = -1
+	}
+	g.side.add(pos-1, g.path[pos].size)
+	g.path = g.path[:pos]
+	g.side.truncate(pos)
+}
+
+// follow extends the path from its end, a parent of n, through n and on
+// through the child with the largest subtree until it reaches a leaf
+func (g *ghostTree) follow(n *ghostNode) {
+	for n != nil {
+		g.side.add(len(g.path)-1, -n.size)
+		n.pos = len(g.path)
+		g.path = append(g.path, n)
+		// none of its children are on the path yet
+		g.side.append(n.size)
+
+		var best *ghostNode
+		for _, c := range n.children {
+			if best == nil || g.better(c, best) {
+				best = c
+			}
+		}
+		n = best
+	}
+}
+
+// head returns the tipset at the end of the GHOST path
+func (g *ghostTree) head() *Tipset {
+	return g.tipset(g.path[len(g.path)-1])
+}
+
+// tipset returns the tipset of the node's blocks, those with the lowest
+// tickets if there are more than the chain's maxTipsetSize
+func (g *ghostTree) tipset(n *ghostNode) *Tipset {
+	if n.ts == nil {
+		n.ts = g.ct.NewTipset(g.ct.capTipset(append([]*Block(nil), n.blocks...)))
+	}
+	return n.ts
+}
+
+// fenwick is a Fenwick tree of counts that grows and shrinks at its end,
+// summing any prefix of them in O(log n)
+type fenwick []int
+
+// append adds a count after the last
+func (f *fenwick) append(v int) {
+	i := len(*f) + 1
+	*f = append(*f, v+f.prefix(i-1)-f.prefix(i-(i&-i)))
+}
+
+// add adds v to the count at pos, counting from 0
+func (f fenwick) add(pos, v int) {
+	for i := pos + 1; i <= len(f); i += i & -i {
+		f[i-1] += v
+	}
+}
+
+// prefix returns the sum of the first n counts
+func (f fenwick) prefix(n int) int {
+	s := 0
+	for i := n; i > 0; i -= i & -i {
+		s += f[i-1]
+	}
+	return s
+}
+
+// truncate keeps the first n counts
+func (f *fenwick) truncate(n int) {
+	*f = (*f)[:n]
+}
+
+// ghostTipset returns the head chosen by GHOST over the chain tracker's block
+// tree.  head, or one of tipsets, is returned when it is the chosen tipset.
+func (ct *ChainTracker) ghostTipset(head *Tipset, tipsets []*Tipset) *Tipset {
+	chosen := ct.ghost.head()
+	if chosen.Name == head.Name {
+		return head
+	}
+	for _, ts := range tipsets {
+		if ts.Name == chosen.Name {
+			return ts
+		}
+	}
+	return chosen
+}
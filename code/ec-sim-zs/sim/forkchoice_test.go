@@ -0,0 +1,161 @@
+package sim
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFenwick(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var f fenwick
+	var counts []int
+	for op := 0; op < 2000; op++ {
+		switch r := rng.Intn(10); {
+		case r < 5 || len(counts) == 0:
+			v := rng.Intn(10)
+			f.append(v)
+			counts = append(counts, v)
+		case r < 9:
+			pos, v := rng.Intn(len(counts)), rng.Intn(7)-3
+			f.add(pos, v)
+			counts[pos] += v
+		default:
+			n := rng.Intn(len(counts))
+			f.truncate(n)
+			counts = counts[:n]
+		}
+		sum := 0
+		for n := 0; n <= len(counts); n++ {
+			if got := f.prefix(n); got != sum {
+				t.Fatalf("after %d operations, sum of the first %d counts is %d, want %d", op+1, n, got, sum)
+			}
+			if n < len(counts) {
+				sum += counts[n]
+			}
+		}
+	}
+}
+
+// walkGhost returns the head GHOST picks over the tree's blocks, walking it
+// from the root and counting every subtree afresh
+func walkGhost(g *ghostTree) *Tipset {
+	var size func(n *ghostNode) int
+	size = func(n *ghostNode) int {
+		s := len(n.blocks)
+		for _, c := range n.children {
+			s += size(c)
+		}
+		return s
+	}
+	tipset := func(n *ghostNode) *Tipset {
+		return g.ct.NewTipset(g.ct.capTipset(append([]*Block(nil), n.blocks...)))
+	}
+	n := g.root
+	for len(n.children) > 0 {
+		best := n.children[0]
+		for _, c := range n.children[1:] {
+			if size(c) > size(best) || (size(c) == size(best) && g.prefer(tipset(c), tipset(best))) {
+				best = c
+			}
+		}
+		n = best
+	}
+	return tipset(n)
+}
+
+func TestGhostTreeMatchesFullWalk(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		tieBreaker    TieBreaker
+		maxTipsetSize int
+		// chance a block joins a fork below the newest heights, as blocks
+		// published late do
+		late float64
+	}{
+		{"min ticket", nil, 0, 0},
+		{"late blocks", nil, 0, 0.3},
+		{"name", nameTieBreaker, 0, 0.1},
+		{"capped", cardinalityTieBreaker, 2, 0.1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(3))
+			ct := NewChainTracker(nil)
+			ct.tieBreaker = tc.tieBreaker
+			ct.maxTipsetSize = tc.maxTipsetSize
+			gen := testGen(t, ct, 1, 4)
+			ct.NewTipset([]*Block{gen})
+			g := newGhostTree(ct)
+			g.add(gen)
+
+			blocks := []*Block{gen}
+			for i := 0; i < 400; i++ {
+				// mine on one of the newest blocks, or any block if late,
+				// and on the rest of its node's blocks half the time
+				from := len(blocks) - 8
+				if from < 0 || rng.Float64() < tc.late {
+					from = 0
+				}
+				p := blocks[from+rng.Intn(len(blocks)-from)]
+				parents := []*Block{p}
+				if rng.Intn(2) == 0 {
+					parents = g.nodes[nodeKey(p)].blocks
+				}
+				blk := &Block{
+					Nonce:    ct.newNonce(),
+					Owner:    rng.Intn(4),
+					Height:   p.Height + 1,
+					Parents:  ct.NewTipset(parents),
+					Seed:     uint64(rng.Int63()),
+					WinCount: 1,
+				}
+				blocks = append(blocks, blk)
+				g.add(blk)
+
+				if got, want := g.head(), walkGhost(g); got.Name != want.Name {
+					t.Fatalf("after block %d, GHOST head is %s, want %s", i+1, got.Name, want.Name)
+				}
+				onPath := 0
+				for _, n := range g.nodes {
+					if n.pos >= 0 {
+						onPath++
+						if n.pos >= len(g.path) || g.path[n.pos] != n {
+							t.Fatalf("after block %d, node at height %d has path position %d", i+1, n.blocks[0].Height, n.pos)
+						}
+					}
+				}
+				if onPath != len(g.path) {
+					t.Fatalf("after block %d, %d nodes are on a path of %d", i+1, onPath, len(g.path))
+				}
+			}
+			if len(g.path) < 20 {
+				t.Errorf("GHOST path of %d nodes, want a longer chain", len(g.path))
+			}
+		})
+	}
+}
+
+func TestGhostTreeKeptOnlyWhenNeeded(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		forkChoice    forkChoiceRule
+		disagreements bool
+		want          bool
+	}{
+		{"heaviest", heaviestTipsetChoice, false, false},
+		{"heaviest counting disagreements", heaviestTipsetChoice, true, true},
+		{"ghost", ghostChoice, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(t, 10, 60, 1)
+			cfg.forkChoice = tc.forkChoice
+			cfg.disagreements = tc.disagreements
+			ct, err := runSim(cfg, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ct.ghost != nil; got != tc.want {
+				t.Errorf("GHOST tree kept: %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
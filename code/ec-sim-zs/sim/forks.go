@@ -0,0 +1,237 @@
+package sim
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// width of the longest bar in printed histograms
+const histogramWidth = 50
+
+// forkGroups returns the blocks mined at height grouped by parent tipset,
+// i.e. the largest tipsets competing at that height.
+func forkGroups(ct *ChainTracker, height int) [][]*Block {
+	byParent := make(map[string][]*Block)
+	var names []string
+	for _, blk := range ct.liveBlocksByHeight[height] {
+		name := ""
+		if blk.Parents != nil {
+			name = blk.Parents.Name
+		}
+		if _, ok := byParent[name]; !ok {
+			names = append(names, name)
+		}
+		byParent[name] = append(byParent[name], blk)
+	}
+
+	groups := make([][]*Block, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, byParent[name])
+	}
+	return groups
+}
+
+// lastDescendantHeights returns, for every non-null block, the height of the
+// highest non-null block descending from it (itself included).
+func lastDescendantHeights(ct *ChainTracker) map[*Block]int {
+	last := make(map[*Block]int)
+	for h := ct.maxHeight; h >= ct.prunedBelow; h-- {
+		for _, blk := range ct.liveBlocksByHeight[h] {
+			if _, ok := last[blk]; !ok {
+				last[blk] = h
+			}
+			if h == ct.prunedBelow {
+				continue
+			}
+			for _, p := range blk.liveParents().Blocks {
+				if last[blk] > last[p] {
+					last[p] = last[blk]
+				}
+			}
+		}
+	}
+	return last
+}
+
+// timeToFirstFork returns the first height at which blocks were mined on
+// more than one parent tipset, or -1 if the chain never forked.
+func timeToFirstFork(ct *ChainTracker) int {
+	for h := ct.prunedBelow; h <= ct.maxHeight; h++ {
+		if len(forkGroups(ct, h)) > 1 {
+			return h
+		}
+	}
+	return -1
+}
+
+// forkLifetimes returns, for every fork that lost out to the canonical chain,
+// the number of rounds between the height it appeared at and the last round
+// in which a block was mined on top of it.  Forks still being extended at the
+// end of the run haven't been abandoned yet and are left out.
+func forkLifetimes(ct *ChainTracker) []int {
+	canonical := headAncestry(ct)
+	last := lastDescendantHeights(ct)
+
+	var lifetimes []int
+	for h := 1; h <= ct.maxHeight; h++ {
+		groups := forkGroups(ct, h)
+		if len(groups) < 2 {
+			continue
+		}
+		for _, group := range groups {
+			lastSeen := h
+			won := false
+			for _, blk := range group {
+				won = won || canonical[blk.Nonce]
+				if last[blk] > lastSeen {
+					lastSeen = last[blk]
+				}
+			}
+			if won || lastSeen == ct.maxHeight {
+				continue
+			}
+			lifetimes = append(lifetimes, lastSeen-h)
+		}
+	}
+	return lifetimes
+}
+
+// percentile returns the nearest-rank p-th percentile (0 < p <= 100) of
+// sorted values.
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// lifetimeSummary returns the min, median, max and 95th percentile of the
+// given fork lifetimes.
+func lifetimeSummary(lifetimes []int) (min, median, max, p95 int) {
+	if len(lifetimes) == 0 {
+		return 0, 0, 0, 0
+	}
+	sorted := append([]int(nil), lifetimes...)
+	sort.Ints(sorted)
+	return sorted[0], percentile(sorted, 50), sorted[len(sorted)-1], percentile(sorted, 95)
+}
+
+// printPrivateForkStats prints, for each miner, the most private forks it
+// kept at once in any trial and the mean over all rounds of all trials.
+func printPrivateForkStats(cts []*ChainTracker) {
+	peak := make(map[int]int)
+	sum := make(map[int]int)
+	rounds := make(map[int]int)
+	for _, ct := range cts {
+		for _, m := range ct.miners {
+			fc := ct.forkCounts[m.ID()]
+			if fc == nil {
+				continue
+			}
+			if fc.peak > peak[m.ID()] {
+				peak[m.ID()] = fc.peak
+			}
+			sum[m.ID()] += fc.total
+			rounds[m.ID()] += fc.rounds
+		}
+	}
+
+	ids := make([]int, 0, len(rounds))
+	for id := range rounds {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	reportln("private forks per miner:")
+	for _, id := range ids {
+		reportf("\tminer %d: peak %d, mean %f\n", id, peak[id], float64(sum[id])/float64(rounds[id]))
+	}
+}
+
+// forkHistogram maps a number of live blocks mined at a height to the number
+// of heights with that many blocks, showing whether forks are rare but wide
+// or common but narrow.  Heights in the warmup aren't counted.
+func forkHistogram(ct *ChainTracker, warmup int) map[int]int {
+	hist := make(map[int]int)
+	for h := ct.firstMeasured(warmup); h <= ct.maxHeight; h++ {
+		hist[len(ct.liveBlocksByHeight[h])]++
+	}
+	return hist
+}
+
+// tipsetSizeDistribution maps a number of blocks to the number of tipsets of
+// the canonical chain with that many, null tipsets and heights in the warmup
+// left out.  Larger tipsets mean more simultaneous winners the chain kept,
+// where forkHistogram counts every live block mined at a height.
+func tipsetSizeDistribution(ct *ChainTracker, warmup int) map[int]int {
+	sizes := make(map[int]int)
+	for ts := ct.head; ts.Blocks[0].Owner != -1 && ts.getHeight() >= ct.firstMeasured(warmup); ts = ts.getParents() {
+		if !ts.Blocks[0].Null {
+			sizes[len(ts.Blocks)]++
+		}
+	}
+	return sizes
+}
+
+// printHistogram prints hist as horizontal ASCII bars, one per key.
+func printHistogram(title string, hist map[int]int) {
+	keys := make([]int, 0, len(hist))
+	max := 0
+	for k, v := range hist {
+		keys = append(keys, k)
+		if v > max {
+			max = v
+		}
+	}
+	sort.Ints(keys)
+
+	reportln(title)
+	for _, k := range keys {
+		bar := 0
+		if max > 0 {
+			bar = int(math.Ceil(float64(hist[k]) / float64(max) * histogramWidth))
+		}
+		reportf("%4d | %s %d\n", k, strings.Repeat("#", bar), hist[k])
+	}
+}
+
+// longestNullRun returns the most consecutive null blocks found on any fork,
+// and the round in which the run reached that depth.  Miners that keep
+// losing extend their forks with null blocks, so long runs mean the network
+// stalled.
+func longestNullRun(ct *ChainTracker) (int, int) {
+	depths := make(map[int]int)
+	var depth func(blk *Block) int
+	depth = func(blk *Block) int {
+		if !blk.Null {
+			return 0
+		}
+		if d, ok := depths[blk.Nonce]; ok {
+			return d
+		}
+		d := 1 + depth(blk.Parents.Blocks[0])
+		depths[blk.Nonce] = d
+		return d
+	}
+
+	longest, round := 0, -1
+	for _, blk := range ct.allBlocks {
+		d := depth(blk)
+		// blocks at height h are mined in round h-1
+		if d > longest || (d == longest && d > 0 && blk.Height-1 < round) {
+			longest, round = d, blk.Height-1
+		}
+	}
+	return longest, round
+}
+
+// maxNullRun returns the most consecutive null blocks found on any fork
+func maxNullRun(ct *ChainTracker) int {
+	longest, _ := longestNullRun(ct)
+	return longest
+}
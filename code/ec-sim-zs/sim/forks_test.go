@@ -0,0 +1,32 @@
+package sim
+
+import "testing"
+
+func TestPrivateForkSeries(t *testing.T) {
+	cfg := testConfig(t, 8, 80, 2)
+	ct, err := runSim(cfg, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forked := false
+	for _, m := range ct.miners {
+		series := ct.privateForkSeries(m.ID())
+		if len(series) != cfg.rounds {
+			t.Fatalf("miner %d has %d rounds of private forks, want %d", m.ID(), len(series), cfg.rounds)
+		}
+		peak, total := 0, 0
+		for _, n := range series {
+			if n > peak {
+				peak = n
+			}
+			total += n
+		}
+		forked = forked || peak > 1
+		if fc := ct.forkCounts[m.ID()]; fc.peak != peak || fc.total != total {
+			t.Errorf("miner %d has peak %d and total %d, series says %d and %d", m.ID(), fc.peak, fc.total, peak, total)
+		}
+	}
+	if !forked {
+		t.Error("no miner kept several private forks")
+	}
+}
@@ -0,0 +1,70 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// writeFrames draws the chain as of every round into dir as frame_000.dot,
+// frame_001.dot, ... for stitching into an animation.  Blocks delivered in a
+// round are at the round's height, so each frame holds the live blocks up to
+// its round, with the ancestry of the head chosen that round in red.  Rounds
+// whose blocks were pruned away aren't drawn.
+func writeFrames(ct *ChainTracker, dir string) {
+	reportf("Writing Frames %s\n", dir)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		panic(err)
+	}
+
+	frame := 0
+	for _, snap := range ct.headTimeline {
+		if snap.Round < ct.prunedBelow {
+			continue
+		}
+		ancestry := ancestryOf(ct, snap.Head)
+		fil, err := os.Create(filepath.Join(dir, fmt.Sprintf("frame_%03d.dot", frame)))
+		if err != nil {
+			panic(err)
+		}
+		writeDot(fil, ct, snap.Round, func(block *Block) bool { return ancestry[block.Nonce] })
+		fil.Close()
+		frame++
+	}
+}
+
+// ancestryOf returns the nonces of the blocks in the tipset named head and
+// all of its ancestors
+func ancestryOf(ct *ChainTracker, head string) map[int]bool {
+	ancestry := make(map[int]bool)
+	var ts *Tipset
+	for _, blk := range blocksNamed(ct, head) {
+		ancestry[blk.Nonce] = true
+		ts = blk.Parents
+	}
+	for ; ts != nil; ts = ts.getParents() {
+		for _, blk := range ts.Blocks {
+			ancestry[blk.Nonce] = true
+		}
+	}
+	return ancestry
+}
+
+// blocksNamed returns the blocks of the tipset named name that weren't
+// pruned away
+func blocksNamed(ct *ChainTracker, name string) []*Block {
+	var blocks []*Block
+	for _, s := range strings.Split(name, "-") {
+		nonce, err := strconv.Atoi(s)
+		if err != nil {
+			panic(fmt.Sprintf("bad tipset name %q", name))
+		}
+		if blk, ok := ct.allBlocks[nonce]; ok {
+			blocks = append(blocks, blk)
+		}
+	}
+	return blocks
+}
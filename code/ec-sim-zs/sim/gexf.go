@@ -0,0 +1,69 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+)
+
+// writeGEXF outputs the chain as a GEXF graph for interactive exploration in
+// Gephi.  As in drawChain, nodes are the non-null blocks and edges point from
+// each block to its live parents.  Blocks in the head's ancestry are colored
+// red and sized up.
+func writeGEXF(ct *ChainTracker, path string) {
+	reportf("Writing GEXF %s\n", path)
+
+	fil, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer fil.Close()
+
+	fmt.Fprintln(fil, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(fil, `<gexf xmlns="http://gexf.net/1.3" xmlns:viz="http://gexf.net/1.3/viz" version="1.3">`)
+	fmt.Fprintln(fil, `  <graph defaultedgetype="directed">`)
+	fmt.Fprintln(fil, `    <attributes class="node">`)
+	fmt.Fprintln(fil, `      <attribute id="owner" title="owner" type="integer"/>`)
+	fmt.Fprintln(fil, `      <attribute id="height" title="height" type="integer"/>`)
+	fmt.Fprintln(fil, `      <attribute id="null" title="null" type="boolean"/>`)
+	fmt.Fprintln(fil, `      <attribute id="inHead" title="inHead" type="boolean"/>`)
+	fmt.Fprintln(fil, `      <attribute id="weight" title="weight" type="integer"/>`)
+	fmt.Fprintln(fil, `    </attributes>`)
+
+	// Write out the blocks
+	fmt.Fprintln(fil, `    <nodes>`)
+	for cur := ct.prunedBelow; cur <= ct.maxHeight; cur++ {
+		for _, block := range ct.liveBlocksByHeight[cur] {
+			fmt.Fprintf(fil, "      <node id=\"b%d\" label=\"b%d (m%d)\">\n", block.Nonce, block.Nonce, block.Owner)
+			fmt.Fprintln(fil, `        <attvalues>`)
+			fmt.Fprintf(fil, "          <attvalue for=\"owner\" value=\"%d\"/>\n", block.Owner)
+			fmt.Fprintf(fil, "          <attvalue for=\"height\" value=\"%d\"/>\n", block.Height)
+			fmt.Fprintf(fil, "          <attvalue for=\"null\" value=\"%t\"/>\n", block.Null)
+			fmt.Fprintf(fil, "          <attvalue for=\"inHead\" value=\"%t\"/>\n", block.InHead)
+			fmt.Fprintf(fil, "          <attvalue for=\"weight\" value=\"%d\"/>\n", ct.weight(block.ParentWeight, block.weight()))
+			fmt.Fprintln(fil, `        </attvalues>`)
+			if block.InHead {
+				fmt.Fprintln(fil, `        <viz:color r="255" g="0" b="0"/>`)
+				fmt.Fprintln(fil, `        <viz:size value="2.0"/>`)
+			} else {
+				fmt.Fprintln(fil, `        <viz:color r="128" g="128" b="128"/>`)
+				fmt.Fprintln(fil, `        <viz:size value="1.0"/>`)
+			}
+			fmt.Fprintln(fil, `      </node>`)
+		}
+	}
+	fmt.Fprintln(fil, `    </nodes>`)
+
+	// link to parents
+	fmt.Fprintln(fil, `    <edges>`)
+	edge := 0
+	for cur := ct.prunedBelow; cur <= ct.maxHeight; cur++ {
+		for _, l := range ct.parentLinks(ct.liveBlocksByHeight[cur]) {
+			fmt.Fprintf(fil, "      <edge id=\"%d\" source=\"b%d\" target=\"b%d\"/>\n", edge, l.child.Nonce, l.parent.Nonce)
+			edge++
+		}
+	}
+	fmt.Fprintln(fil, `    </edges>`)
+
+	fmt.Fprintln(fil, `  </graph>`)
+	fmt.Fprintln(fil, `</gexf>`)
+}
@@ -0,0 +1,182 @@
+package sim
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// HeatmapConfig asks a sweep for a grid of one metric over miner counts and
+// lookbacks
+type HeatmapConfig struct {
+	// metric averaged over trials in each cell: forks, orphans, finality or
+	// wasted
+	Metric string `json:"metric"`
+	// parameter along the rows, "miners" (default) or "lbp"; the other one
+	// goes along the columns
+	Rows string `json:"rows"`
+	// also render the grid as an SVG heatmap
+	SVG bool `json:"svg"`
+}
+
+// validate checks the metric and axes are known
+func (hc *HeatmapConfig) validate() error {
+	if _, err := heatmapMetric(hc.Metric, &analysisParams{}); err != nil {
+		return err
+	}
+	if hc.Rows != "" && hc.Rows != "miners" && hc.Rows != "lbp" {
+		return fmt.Errorf("unknown heatmap rows %q: must be miners or lbp", hc.Rows)
+	}
+	return nil
+}
+
+// heatmapMetric returns the per-trial metric with the given name
+func heatmapMetric(name string, ap *analysisParams) (func(ct *ChainTracker) float64, error) {
+	switch name {
+	case "", "forks":
+		return func(ct *ChainTracker) float64 { return averageLiveForksPerRound(ct, ap.warmup) }, nil
+	case "orphans":
+		return func(ct *ChainTracker) float64 { return orphanRate(ct, ap.warmup) }, nil
+	case "finality":
+		return func(ct *ChainTracker) float64 { return averageFinalityDepth(ct, ap.confidence, ap.warmup) }, nil
+	case "wasted":
+		return func(ct *ChainTracker) float64 { return wastedWorkFraction(ct, ap.warmup) }, nil
+	}
+	return nil, fmt.Errorf("unknown heatmap metric %q: must be forks, orphans, finality or wasted", name)
+}
+
+// heatmap is a grid of a metric over two sweep parameters
+type heatmap struct {
+	metric           string
+	rowName, colName string
+	rows, cols       []int
+	// values[i][j] is the cell for rows[i] and cols[j]
+	values [][]float64
+}
+
+// newHeatmap lays out a grid over the sweep's miner counts and lookbacks
+func newHeatmap(hc *HeatmapConfig, sc *SweepConfig) *heatmap {
+	hm := &heatmap{metric: hc.Metric, rowName: "miners", colName: "lbp", rows: sc.Miners, cols: sc.LBPs}
+	if hm.metric == "" {
+		hm.metric = "forks"
+	}
+	if hc.Rows == "lbp" {
+		hm.rowName, hm.colName = hm.colName, hm.rowName
+		hm.rows, hm.cols = hm.cols, hm.rows
+	}
+	hm.values = make([][]float64, len(hm.rows))
+	for i := range hm.values {
+		hm.values[i] = make([]float64, len(hm.cols))
+	}
+	return hm
+}
+
+// set records the cell of the given miner count and lookback
+func (hm *heatmap) set(miners, lbp int, v float64) {
+	r, c := miners, lbp
+	if hm.rowName == "lbp" {
+		r, c = c, r
+	}
+	for i, row := range hm.rows {
+		for j, col := range hm.cols {
+			if row == r && col == c {
+				hm.values[i][j] = v
+			}
+		}
+	}
+}
+
+// writeCSV outputs the grid as a CSV matrix: the header row holds the column
+// values and each row starts with its row value
+func (hm *heatmap) writeCSV(path string) {
+	reportf("Writing Heatmap %s\n", path)
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			panic(err)
+		}
+	}
+
+	fil, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer fil.Close()
+
+	w := csv.NewWriter(fil)
+	header := []string{fmt.Sprintf("%s\\%s", hm.rowName, hm.colName)}
+	for _, col := range hm.cols {
+		header = append(header, strconv.Itoa(col))
+	}
+	if err := w.Write(header); err != nil {
+		panic(err)
+	}
+	for i, row := range hm.rows {
+		record := []string{strconv.Itoa(row)}
+		for _, v := range hm.values[i] {
+			record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		if err := w.Write(record); err != nil {
+			panic(err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		panic(err)
+	}
+}
+
+// size in pixels of a heatmap cell and of the margin holding the labels
+const (
+	heatmapCell   = 60
+	heatmapMargin = 80
+)
+
+// writeSVG renders the grid as an SVG heatmap shading cells from white (the
+// lowest value) to red (the highest) and labelling each with its value
+func (hm *heatmap) writeSVG(path string) {
+	reportf("Writing Heatmap %s\n", path)
+
+	fil, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer fil.Close()
+
+	lo, hi := hm.values[0][0], hm.values[0][0]
+	for _, row := range hm.values {
+		for _, v := range row {
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+	}
+
+	width := heatmapMargin + heatmapCell*len(hm.cols)
+	height := heatmapMargin + heatmapCell*len(hm.rows)
+	fmt.Fprintf(fil, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"sans-serif\" font-size=\"12\">\n", width, height)
+	fmt.Fprintf(fil, "  <text x=\"4\" y=\"16\">%s</text>\n", hm.metric)
+	fmt.Fprintf(fil, "  <text x=\"4\" y=\"%d\">%s \\ %s</text>\n", heatmapMargin-8, hm.rowName, hm.colName)
+	for j, col := range hm.cols {
+		fmt.Fprintf(fil, "  <text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%d</text>\n", heatmapMargin+heatmapCell*j+heatmapCell/2, heatmapMargin-24, col)
+	}
+	for i, row := range hm.rows {
+		y := heatmapMargin + heatmapCell*i
+		fmt.Fprintf(fil, "  <text x=\"%d\" y=\"%d\" text-anchor=\"end\">%d</text>\n", heatmapMargin-8, y+heatmapCell/2, row)
+		for j, v := range hm.values[i] {
+			x := heatmapMargin + heatmapCell*j
+			shade := 255
+			if hi > lo {
+				shade = 255 - int(255*(v-lo)/(hi-lo))
+			}
+			fmt.Fprintf(fil, "  <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"rgb(255,%d,%d)\" stroke=\"#ccc\"/>\n", x, y, heatmapCell, heatmapCell, shade, shade)
+			fmt.Fprintf(fil, "  <text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%.3g</text>\n", x+heatmapCell/2, y+heatmapCell/2, v)
+		}
+	}
+	fmt.Fprintln(fil, "</svg>")
+}
@@ -0,0 +1,263 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chainFile mirrors the JSON written by writeChain
+type chainFile struct {
+	Blocks       []*Block       `json:"blocks"`
+	Miners       []minerRecord  `json:"miners"`
+	Genesis      []*Block       `json:"genesis"`
+	Pending      []*Block       `json:"pending"`
+	Timeline     []HeadSnapshot `json:"headTimeline"`
+	LBP          int            `json:"lbp"`
+	LBPSchedule  lbpSchedule    `json:"lbpSchedule"`
+	TicketSpace  uint64         `json:"ticketSpace"`
+	BlockTime    time.Duration  `json:"blockTime"`
+	Weight       string         `json:"weight"`
+	MaxTipset    int            `json:"maxTipsetSize"`
+	ForkChoice   string         `json:"forkChoice"`
+	Attempts     map[int]int    `json:"attempts"`
+	Wins         map[int]int    `json:"wins"`
+	PrunedBelow  int            `json:"prunedBelow"`
+	Difficulty   float64        `json:"difficulty"`
+	Difficulties []float64      `json:"difficultySeries"`
+	Heads        []int          `json:"distinctHeads"`
+	MaxHeight    *int           `json:"maxHeight"`
+	Head         string         `json:"head"`
+}
+
+// minerRecord holds the serialized fields of all miner strategies
+type minerRecord struct {
+	Power        float64            `json:"power"`
+	HashRate     float64            `json:"hashRate"`
+	ID           int                `json:"id"`
+	Honest       bool               `json:"honest"`
+	Adversary    bool               `json:"adversary"`
+	Attack       string             `json:"attack"`
+	Depth        int                `json:"depth"`
+	PrivateForks map[string]*Tipset `json:"privateForks"`
+	Base         *Tipset            `json:"base"`
+	HeadName     string             `json:"headName"`
+}
+
+// loadChain reads a chain written by writeChain and rebuilds its chain
+// tracker, relinking every block to its parent tipset by name.
+func loadChain(path string) (*ChainTracker, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cf chainFile
+	if err := json.Unmarshal(data, &cf); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+	if len(cf.Blocks) == 0 {
+		return nil, fmt.Errorf("%s contains no blocks", path)
+	}
+
+	if cf.MaxTipset < 0 {
+		return nil, fmt.Errorf("%s: invalid maximum tipset size %d", path, cf.MaxTipset)
+	}
+
+	forkChoice := heaviestTipsetChoice
+	if cf.ForkChoice != "" {
+		if forkChoice, err = parseForkChoice(cf.ForkChoice); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	if cf.TicketSpace == 0 {
+		cf.TicketSpace = bigOlNum
+	}
+
+	miners := make([]Miner, len(cf.Miners))
+	for i, mr := range cf.Miners {
+		switch {
+		case mr.Attack == "balance":
+			miners[i] = NewBalanceAttacker(mr.ID, mr.Power, len(cf.Miners), cf.TicketSpace, nil)
+		case mr.Attack == "reorg":
+			miners[i] = NewReorgAttacker(mr.ID, mr.Power, len(cf.Miners), cf.TicketSpace, nil, mr.Depth)
+		case mr.Honest:
+			hm := NewHonestMiner(mr.ID, mr.Power, len(cf.Miners), cf.TicketSpace, nil)
+			hm.Adversary = mr.Adversary
+			hm.HeadName = mr.HeadName
+			miners[i] = hm
+		default:
+			rm := NewRationalMiner(mr.ID, mr.Power, len(cf.Miners), cf.TicketSpace, nil)
+			rm.Adversary = mr.Adversary
+			miners[i] = rm
+		}
+		rationalMiner(miners[i]).HashRate = mr.HashRate
+	}
+	ct := NewChainTracker(miners)
+	// chains saved before schedules were only ever mined with one lookback
+	ct.lbps = cf.LBPSchedule
+	if ct.lbps == nil {
+		ct.lbps = constantLBP(cf.LBP)
+	}
+	if err := ct.lbps.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	ct.forkChoice = forkChoice
+	// tipset weights are recomputed as parents are relinked
+	if err := ct.setWeight(cf.Weight); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	ct.maxTipsetSize = cf.MaxTipset
+	ct.ticketSpace = cf.TicketSpace
+	ct.blockTime = cf.BlockTime
+	if cf.Attempts != nil {
+		ct.attempts = cf.Attempts
+	}
+	if cf.Wins != nil {
+		ct.wins = cf.Wins
+	}
+	ct.headTimeline = cf.Timeline
+	ct.prunedBelow = cf.PrunedBelow
+	ct.difficulties = cf.Difficulties
+	ct.distinctHeads = cf.Heads
+	if cf.Difficulty > 0 {
+		ct.difficulty = cf.Difficulty
+	}
+
+	l := &tipsetLinker{
+		ct:      ct,
+		blocks:  make(map[int]*Block),
+		tipsets: make(map[string]*Tipset),
+	}
+	for _, blk := range cf.Genesis {
+		l.blocks[blk.Nonce] = blk
+	}
+	for _, blk := range cf.Blocks {
+		l.blocks[blk.Nonce] = blk
+		ct.allBlocks[blk.Nonce] = blk
+	}
+	for _, blk := range cf.Pending {
+		l.blocks[blk.Nonce] = blk
+	}
+	ct.pending = cf.Pending
+
+	// relink parents now that every block is known
+	for _, blk := range l.blocks {
+		if blk.Parents == nil {
+			continue
+		}
+		parents, err := l.link(blk.Parents.Name)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %s", blk.Nonce, err)
+		}
+		if parents.Weight != blk.Parents.Weight || parents.MinTicket != blk.Parents.MinTicket {
+			return nil, fmt.Errorf("block %d: parent tipset %s does not match its serialized weight or ticket", blk.Nonce, parents.Name)
+		}
+		parents.WasHead = parents.WasHead || blk.Parents.WasHead
+		blk.Parents = parents
+	}
+
+	maxHeight := -1
+	for _, blk := range cf.Blocks {
+		if blk.Null {
+			continue
+		}
+		ct.liveBlocksByHeight[blk.Height] = append(ct.liveBlocksByHeight[blk.Height], blk)
+		if blk.Height > maxHeight {
+			maxHeight = blk.Height
+		}
+	}
+	for _, blocks := range ct.liveBlocksByHeight {
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i].Nonce < blocks[j].Nonce })
+	}
+	if _, ok := ct.liveBlocksByHeight[cf.PrunedBelow]; !ok {
+		return nil, fmt.Errorf("%s has no genesis block, or oldest block at height %d if pruned", path, cf.PrunedBelow)
+	}
+	ct.maxHeight = maxHeight
+	if cf.MaxHeight != nil {
+		ct.maxHeight = *cf.MaxHeight
+	}
+
+	// blocks mined in round r are at height r+1, and the last round's are
+	// still pending.  Rounds pruned away aren't known.
+	for h := ct.prunedBelow + 1; h <= ct.maxHeight; h++ {
+		ct.blocksPerRound = append(ct.blocksPerRound, len(ct.liveBlocksByHeight[h]))
+	}
+	if len(cf.Pending) > 0 {
+		ct.blocksPerRound = append(ct.blocksPerRound, len(cf.Pending))
+	}
+	// chains written before wins were tracked count rounds in which no
+	// block was published
+	for i, n := range ct.blocksPerRound {
+		if cf.Wins != nil {
+			n = ct.wins[ct.prunedBelow+1+i]
+		}
+		if n == 0 {
+			ct.stalls++
+		}
+	}
+
+	if cf.Head == "" {
+		return nil, fmt.Errorf("%s has no head", path)
+	}
+	if ct.head, err = l.link(cf.Head); err != nil {
+		return nil, fmt.Errorf("head: %s", err)
+	}
+	ct.head.WasHead = true
+
+	// private forks and honest miners' bases, for resuming the chain
+	for i, mr := range cf.Miners {
+		rm := rationalMiner(miners[i])
+		for name := range mr.PrivateForks {
+			if rm.PrivateForks[name], err = l.link(name); err != nil {
+				return nil, fmt.Errorf("miner %d: private fork: %s", mr.ID, err)
+			}
+		}
+		if hm, ok := miners[i].(*HonestMiner); ok && mr.Base != nil {
+			if hm.Base, err = l.link(mr.Base.Name); err != nil {
+				return nil, fmt.Errorf("miner %d: base: %s", mr.ID, err)
+			}
+		}
+	}
+	return ct, nil
+}
+
+// tipsetLinker rebuilds tipsets from their names, sharing a single Tipset
+// between all blocks with the same parents
+type tipsetLinker struct {
+	ct      *ChainTracker
+	blocks  map[int]*Block
+	tipsets map[string]*Tipset
+}
+
+func (l *tipsetLinker) link(name string) (*Tipset, error) {
+	if ts, ok := l.tipsets[name]; ok {
+		return ts, nil
+	}
+
+	var blocks []*Block
+	for _, s := range strings.Split(name, "-") {
+		nonce, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad tipset name %q", name)
+		}
+		blk, ok := l.blocks[nonce]
+		if !ok {
+			return nil, fmt.Errorf("tipset %s references unknown block %d", name, nonce)
+		}
+		blocks = append(blocks, blk)
+	}
+	ts, err := l.ct.checkedTipset(blocks)
+	if err != nil {
+		return nil, err
+	}
+	if ts.Name != name {
+		return nil, fmt.Errorf("tipset %s rebuilt as %s", name, ts.Name)
+	}
+	l.tipsets[name] = ts
+	return ts, nil
+}
@@ -0,0 +1,216 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// loadTestChains returns chains of several shapes to write out and load
+// back, by name
+func loadTestChains(t *testing.T) map[string]*ChainTracker {
+	chains := make(map[string]*ChainTracker)
+	for _, tc := range []struct {
+		name                string
+		miners, rounds, lbp int
+		prune               int
+	}{
+		{"single lookback", 6, 30, 1, 0},
+		{"long lookback", 8, 40, 5, 0},
+		{"pruned", 8, 60, 3, 10},
+	} {
+		cfg := testConfig(t, tc.miners, tc.rounds, tc.lbp)
+		cfg.prune = tc.prune
+		ct, err := runSim(cfg, 7)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		chains[tc.name] = ct
+	}
+	scenario, err := buildScenario(reorgScenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains["scenario"] = scenario
+	return chains
+}
+
+// blockSummary describes everything about a block that writeChain saves
+func blockSummary(blk *Block) string {
+	return fmt.Sprintf("b%d m%d h%d null=%t ticket=%d parents=%s pw=%d wins=%d proof=%d inHead=%t at %s",
+		blk.Nonce, blk.Owner, blk.Height, blk.Null, blk.Seed, parentName(blk), blk.ParentWeight, blk.WinCount, blk.ElectionProof, blk.InHead, blk.Timestamp)
+}
+
+func TestLoadChainRoundTrip(t *testing.T) {
+	for name, ct := range loadTestChains(t) {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeChain(ct, "chain", dir)
+			loaded, err := loadChain(filepath.Join(dir, "chain.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(loaded.allBlocks) != len(ct.allBlocks) {
+				t.Fatalf("loaded %d blocks, want %d", len(loaded.allBlocks), len(ct.allBlocks))
+			}
+			for nonce, blk := range ct.allBlocks {
+				got, ok := loaded.allBlocks[nonce]
+				if !ok {
+					t.Errorf("block %d is missing", nonce)
+					continue
+				}
+				if blockSummary(got) != blockSummary(blk) {
+					t.Errorf("loaded %s, want %s", blockSummary(got), blockSummary(blk))
+				}
+			}
+
+			heights := func(ct *ChainTracker) string {
+				var hs []string
+				for h, blocks := range ct.liveBlocksByHeight {
+					nonces := make([]int, len(blocks))
+					for i, blk := range blocks {
+						nonces[i] = blk.Nonce
+					}
+					sort.Ints(nonces)
+					hs = append(hs, fmt.Sprint(h, nonces))
+				}
+				sort.Strings(hs)
+				return fmt.Sprint(hs)
+			}
+			if got, want := heights(loaded), heights(ct); got != want {
+				t.Errorf("live blocks by height %s, want %s", got, want)
+			}
+			if loaded.maxHeight != ct.maxHeight || loaded.prunedBelow != ct.prunedBelow {
+				t.Errorf("heights %d-%d, want %d-%d", loaded.prunedBelow, loaded.maxHeight, ct.prunedBelow, ct.maxHeight)
+			}
+			if loaded.head.Name != ct.head.Name || loaded.head.Weight != ct.head.Weight {
+				t.Errorf("head %s of weight %d, want %s of weight %d", loaded.head.Name, loaded.head.Weight, ct.head.Name, ct.head.Weight)
+			}
+			if len(loaded.miners) != len(ct.miners) {
+				t.Errorf("%d miners, want %d", len(loaded.miners), len(ct.miners))
+			}
+		})
+	}
+}
+
+func TestWriteChainRoundTripIsByteStable(t *testing.T) {
+	for name, ct := range loadTestChains(t) {
+		t.Run(name, func(t *testing.T) {
+			first, second := t.TempDir(), t.TempDir()
+			writeChain(ct, "chain", first)
+			loaded, err := loadChain(filepath.Join(first, "chain.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeChain(loaded, "chain", second)
+
+			want, err := os.ReadFile(filepath.Join(first, "chain.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(filepath.Join(second, "chain.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				gl, wl := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+				for i := 0; i < len(gl) && i < len(wl); i++ {
+					if gl[i] != wl[i] {
+						t.Fatalf("rewritten chain differs at line %d: %q, want %q", i+1, gl[i], wl[i])
+					}
+				}
+				t.Fatalf("rewritten chain has %d lines, want %d", len(gl), len(wl))
+			}
+		})
+	}
+}
+
+func TestLoadChainKeepsItsWeight(t *testing.T) {
+	dir := t.TempDir()
+	weights := []string{"log", "additive", "discount"}
+	for _, w := range weights {
+		cfg := testConfig(t, 6, 30, 2)
+		cfg.weight = w
+		ct, err := runSim(cfg, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeChain(ct, w, dir)
+	}
+
+	// load every chain before checking any, so that loading one can't
+	// change how another is weighed
+	loaded := make(map[string]*ChainTracker)
+	for _, w := range weights {
+		ct, err := loadChain(filepath.Join(dir, w+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded[w] = ct
+	}
+	for _, w := range weights {
+		ct := loaded[w]
+		if ct.weightName != w {
+			t.Errorf("chain saved with %s weight loaded with %s", w, ct.weightName)
+		}
+		wf, _ := parseWeightFunc(w)
+		live := 0
+		for _, blk := range ct.head.Blocks {
+			live += blk.weight()
+		}
+		if got, want := ct.NewTipset(ct.head.Blocks).Weight, wf(ct.head.Blocks[0].ParentWeight, live); got != want {
+			t.Errorf("%s chain weighs its head %d, want %d", w, got, want)
+		}
+	}
+	if NewChainTracker(nil).weightName != "additive" {
+		t.Error("loading chains changed the default weight")
+	}
+}
+
+func TestLoadChainKeepsItsTipsetCap(t *testing.T) {
+	dir := t.TempDir()
+	caps := []int{2, 0}
+	for _, max := range caps {
+		cfg := testConfig(t, 20, 30, 1)
+		cfg.maxTipsetSize = max
+		ct, err := runSim(cfg, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeChain(ct, fmt.Sprint("cap", max), dir)
+	}
+
+	loaded := make(map[int]*ChainTracker)
+	for _, max := range caps {
+		ct, err := loadChain(filepath.Join(dir, fmt.Sprintf("cap%d.json", max)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded[max] = ct
+	}
+	for _, max := range caps {
+		ct := loaded[max]
+		if ct.maxTipsetSize != max {
+			t.Errorf("chain saved with tipsets capped at %d loaded capped at %d", max, ct.maxTipsetSize)
+		}
+		largest := 0
+		for _, blocks := range ct.liveBlocksByHeight {
+			for _, ts := range ct.allTipsets(blocks) {
+				if len(ts.Blocks) > largest {
+					largest = len(ts.Blocks)
+				}
+			}
+		}
+		if max > 0 && largest > max {
+			t.Errorf("chain capped at %d has a tipset of %d blocks", max, largest)
+		}
+		if max == 0 && largest <= 2 {
+			t.Errorf("uncapped chain's largest tipset has %d blocks, want more than the other chain's cap", largest)
+		}
+	}
+}
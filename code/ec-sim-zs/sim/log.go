@@ -0,0 +1,117 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// logger receives the output of logf: round summaries, head changes, miner
+// forks and blocks, and the reports and progress of reportf.  Parallel
+// trials share it.
+var logger = &logSink{w: os.Stderr, out: os.Stdout}
+
+// logSink writes log messages to w as text, or as JSON lines of the form
+// {"level":"rounds","msg":"setting head to 5"}.  logf is called with partial
+// lines, so in JSON mode text is buffered until its line ends, and blank
+// lines are dropped.
+type logSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	// reports, written as text whatever the log format
+	out     io.Writer
+	json    bool
+	pending bytes.Buffer
+	level   int
+}
+
+// SetLogWriter directs everything the simulator prints to w, logf's output
+// along with the reports and progress otherwise printed to stdout, e.g. to
+// capture or discard it when embedding the simulator
+func SetLogWriter(w io.Writer) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.flush()
+	logger.w = w
+	logger.out = w
+}
+
+// reportf prints part of a report, or progress, to stdout unless redirected
+// by SetLogWriter
+func reportf(format string, args ...interface{}) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	fmt.Fprintf(logger.out, format, args...)
+}
+
+// reportln prints a line of a report like reportf
+func reportln(args ...interface{}) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	fmt.Fprintln(logger.out, args...)
+}
+
+// SetLogJSON switches logf's output between text and JSON lines
+func SetLogJSON(on bool) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.flush()
+	logger.json = on
+}
+
+// logLevelNames names the verbosity levels in JSON lines
+var logLevelNames = map[int]string{logRounds: "rounds", logMiners: "miners", logBlocks: "blocks"}
+
+func (l *logSink) printf(level int, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.json {
+		fmt.Fprintf(l.w, format, args...)
+		return
+	}
+
+	// a partial line is logged at the level of its first part
+	if l.pending.Len() == 0 {
+		l.level = level
+	}
+	fmt.Fprintf(&l.pending, format, args...)
+	for {
+		line, err := l.pending.ReadString('\n')
+		if err != nil {
+			// no newline yet, keep the rest for later
+			l.pending.Reset()
+			l.pending.WriteString(line)
+			return
+		}
+		l.writeJSON(line[:len(line)-1])
+		l.level = level
+	}
+}
+
+// flush writes out a buffered partial line
+func (l *logSink) flush() {
+	if l.pending.Len() > 0 {
+		l.writeJSON(l.pending.String())
+		l.pending.Reset()
+	}
+}
+
+func (l *logSink) writeJSON(msg string) {
+	// blank lines only space out the text log
+	msg = strings.TrimRight(msg, " \t")
+	if msg == "" {
+		return
+	}
+	line, err := json.Marshal(struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{logLevelNames[l.level], msg})
+	if err != nil {
+		panic(err)
+	}
+	l.w.Write(append(line, '\n'))
+}
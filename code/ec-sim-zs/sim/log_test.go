@@ -0,0 +1,98 @@
+package sim
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSetLogWriterSilencesSim(t *testing.T) {
+	// anything printed straight to stdout or stderr lands in these files
+	stdout, stderr := os.Stdout, os.Stderr
+	var err error
+	if os.Stdout, err = os.CreateTemp(t.TempDir(), "stdout"); err != nil {
+		t.Fatal(err)
+	}
+	if os.Stderr, err = os.CreateTemp(t.TempDir(), "stderr"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.Stdout.Close()
+		os.Stderr.Close()
+		os.Stdout, os.Stderr = stdout, stderr
+		logger.mu.Lock()
+		logger.w, logger.out = os.Stderr, os.Stdout
+		logger.mu.Unlock()
+	}()
+
+	var buf bytes.Buffer
+	SetLogWriter(&buf)
+	cfg := testConfig(t, 6, 30, 1)
+	cfg.verbosity = logRounds
+	cts, err := runTrials(cfg, 2, func(n int) int64 { return int64(n) }, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzeSim(cts, &analysisParams{confidence: 6, qualityWindow: 10, giniWindow: 10})
+	printFairness(cts)
+	printPrivateForkStats(cts)
+	printTopologyStats(cts)
+
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		if info, err := f.Stat(); err != nil {
+			t.Fatal(err)
+		} else if info.Size() > 0 {
+			t.Errorf("%d bytes printed to %s past the log writer", info.Size(), f.Name())
+		}
+	}
+	for _, want := range []string{"Trial 1", "setting head", "average live forks per round"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("log writer got no %q", want)
+		}
+	}
+}
+
+func TestVerbosityPerRun(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogWriter(&buf)
+	defer func() {
+		logger.mu.Lock()
+		logger.w, logger.out = os.Stderr, os.Stdout
+		logger.mu.Unlock()
+	}()
+
+	seed := int64(3)
+	cfg := DefaultConfig()
+	cfg.Miners, cfg.Rounds, cfg.Seed = 6, 30, &seed
+	verbose, quiet := cfg, cfg
+	verbose.Verbosity, quiet.Verbosity = logRounds, 0
+	heads := func() int {
+		return bytes.Count(buf.Bytes(), []byte("setting head"))
+	}
+
+	if _, err := Run(verbose); err != nil {
+		t.Fatal(err)
+	}
+	want := heads()
+	if want == 0 {
+		t.Fatal("verbose run logged no head changes")
+	}
+	buf.Reset()
+
+	// a quiet run alongside doesn't silence the verbose one, nor log itself
+	errs := make(chan error, 2)
+	for _, c := range []Config{verbose, quiet} {
+		go func(c Config) {
+			_, err := Run(c)
+			errs <- err
+		}(c)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := heads(); got != want {
+		t.Errorf("%d head changes logged by a verbose and a quiet run, want the verbose run's %d", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+)
+
+// largest chain, in live blocks, writeMermaid renders readably
+const mermaidMaxBlocks = 200
+
+// writeMermaid outputs the chain as a Mermaid "graph TD" diagram that can be
+// pasted into Markdown.  As in drawChain, nodes are the non-null blocks and
+// edges point from each block to its live parents; blocks in the head's
+// ancestry are styled with the head class.
+func writeMermaid(ct *ChainTracker, path string) {
+	reportf("Writing Mermaid %s\n", path)
+	if n := liveBlockCount(ct); n > mermaidMaxBlocks {
+		reportf("warning: %d blocks is too many to render readably with Mermaid (max %d)\n", n, mermaidMaxBlocks)
+	}
+
+	fil, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer fil.Close()
+
+	fmt.Fprintln(fil, "graph TD")
+	fmt.Fprintln(fil, "\tclassDef head fill:#fdd,stroke:#f00,stroke-width:2px;")
+	for cur := ct.maxHeight; cur >= ct.prunedBelow; cur-- {
+		for _, block := range ct.liveBlocksByHeight[cur] {
+			// print block
+			fmt.Fprintf(fil, "\tb%d[\"b%d (m%d)\"]", block.Nonce, block.Nonce, block.Owner)
+			if block.InHead {
+				fmt.Fprint(fil, ":::head")
+			}
+			fmt.Fprintln(fil)
+		}
+
+		// link to parents
+		for _, l := range ct.parentLinks(ct.liveBlocksByHeight[cur]) {
+			fmt.Fprintf(fil, "\tb%d --> b%d\n", l.child.Nonce, l.parent.Nonce)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// strategyOrder lists the strategies a StrategyMix can hold, in the order
+// miner IDs are handed out: honest miners take the lowest IDs and balance and
+// reorg attackers, which are adversaries, the highest, as with -honest and
+// -attack.  Selfish mining isn't modeled: reorg attackers withhold a private
+// chain to rewrite the canonical one, but never race the honest chain block
+// for block.
+var strategyOrder = []string{"honest", "rational", "balance", "reorg"}
+
+// StrategyMix gives the relative weight of each strategy among the miners,
+// e.g. {"rational": 6, "honest": 2, "balance": 1}.  Weights are scaled to the
+// number of miners, so the same mix can be swept over miner counts.
+type StrategyMix map[string]float64
+
+// parseStrategyMix parses a spec of the form "rational:6,honest:2,balance:1"
+func parseStrategyMix(spec string) (StrategyMix, error) {
+	mix := make(StrategyMix)
+	for _, entry := range strings.Split(spec, ",") {
+		kv := strings.Split(entry, ":")
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("mix entry %q must be of the form strategy:weight", entry)
+		}
+		w, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %q for %s", kv[1], kv[0])
+		}
+		if _, ok := mix[kv[0]]; ok {
+			return nil, fmt.Errorf("strategy %s given twice", kv[0])
+		}
+		mix[kv[0]] = w
+	}
+	return mix, mix.validate()
+}
+
+// validate checks that the mix only holds known strategies with
+// non-negative weights, not all zero
+func (mix StrategyMix) validate() error {
+	var total float64
+	for strategy, w := range mix {
+		known := false
+		for _, s := range strategyOrder {
+			known = known || s == strategy
+		}
+		if strategy == "selfish" {
+			return fmt.Errorf("strategy selfish is not supported: must be %s", strings.Join(strategyOrder, ", "))
+		}
+		if !known {
+			return fmt.Errorf("unknown strategy %q: must be %s", strategy, strings.Join(strategyOrder, ", "))
+		}
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return fmt.Errorf("invalid weight %g for %s", w, strategy)
+		}
+		total += w
+	}
+	if total <= 0 {
+		return fmt.Errorf("mix needs a positive weight")
+	}
+	return nil
+}
+
+// counts splits total miners between the strategies in proportion to their
+// weights, in strategyOrder.  Miners left over from rounding down go to the
+// strategies with the largest remainders, earlier ones first on ties.
+func (mix StrategyMix) counts(total int) []int {
+	var sum float64
+	for _, w := range mix {
+		sum += w
+	}
+	counts := make([]int, len(strategyOrder))
+	rems := make([]float64, len(strategyOrder))
+	assigned := 0
+	for i, s := range strategyOrder {
+		share := mix[s] / sum * float64(total)
+		counts[i] = int(share)
+		rems[i] = share - float64(counts[i])
+		assigned += counts[i]
+	}
+	byRem := make([]int, len(strategyOrder))
+	for i := range byRem {
+		byRem[i] = i
+	}
+	sort.SliceStable(byRem, func(a, b int) bool { return rems[byRem[a]] > rems[byRem[b]] })
+	for _, i := range byRem[:total-assigned] {
+		counts[i]++
+	}
+	return counts
+}
+
+// defaultMix returns the mix given by -honest, -adversary and -attack: the
+// first honestFrac of the miners are honest, the adversaries follow the
+// attack if attacking, and the rest rational.  See checkRoles for honest
+// miners and adversaries not overlapping.
+func (cfg *simConfig) defaultMix() StrategyMix {
+	total := cfg.totalMiners
+	honest := int(cfg.honestFrac * float64(total))
+	attackers := 0
+	if cfg.attack != "" {
+		attackers = int(cfg.adversaryFrac * float64(total))
+	}
+	mix := StrategyMix{
+		"honest":   float64(honest),
+		"rational": float64(total - honest - attackers),
+		"balance":  0,
+		"reorg":    0,
+	}
+	if cfg.attack != "" {
+		mix[cfg.attack] = float64(attackers)
+	}
+	return mix
+}
+
+// checkRoles returns an error if some miners would be both honest and
+// adversaries.  Honest miners, from -honest or the mix, take the lowest IDs
+// and the adversaryFrac tagged as adversaries the highest, so there can't be
+// more of them together than miners.
+func (cfg *simConfig) checkRoles() error {
+	total := cfg.totalMiners
+	honest := int(cfg.honestFrac * float64(total))
+	if cfg.mix != nil {
+		honest = cfg.mix.counts(total)[0]
+	}
+	firstAdversary := total - int(cfg.adversaryFrac*float64(total))
+	switch {
+	case honest == firstAdversary+1:
+		return fmt.Errorf("miner %d of %d would be both honest and an adversary", firstAdversary, total)
+	case honest > firstAdversary:
+		return fmt.Errorf("miners %d to %d of %d would be both honest and adversaries", firstAdversary, honest-1, total)
+	}
+	return nil
+}
+
+// buildMiners makes one miner per power, following the strategies of mix,
+// with IDs handed out in strategyOrder.  Miner n draws from an RNG derived
+// from seed and n, and the highest adversaryFrac of the IDs are tagged as
+// adversaries.
+func (cfg *simConfig) buildMiners(mix StrategyMix, powers []float64, seed int64) []Miner {
+	total := len(powers)
+	firstAdversary := total - int(cfg.adversaryFrac*float64(total))
+	miners := make([]Miner, 0, total)
+	for i, count := range mix.counts(total) {
+		for n := 0; n < count; n++ {
+			id := len(miners)
+			var m Miner
+			switch strategyOrder[i] {
+			case "honest":
+				hm := NewHonestMiner(id, powers[id], total, cfg.ticketSpace, minerRand(seed, id))
+				hm.Adversary = id >= firstAdversary
+				m = hm
+			case "rational":
+				rm := NewRationalMiner(id, powers[id], total, cfg.ticketSpace, minerRand(seed, id))
+				rm.Adversary = id >= firstAdversary
+				rm.MaxForks = cfg.maxForks
+				rm.Risk = cfg.risk
+				m = rm
+			case "balance":
+				m = NewBalanceAttacker(id, powers[id], total, cfg.ticketSpace, minerRand(seed, id))
+			case "reorg":
+				m = NewReorgAttacker(id, powers[id], total, cfg.ticketSpace, minerRand(seed, id), cfg.reorgDepth)
+			}
+			rm := rationalMiner(m)
+			if cfg.hashRates != nil {
+				rm.HashRate = cfg.hashRates[id]
+			}
+			rm.Election = cfg.election
+			rm.Oracle = cfg.oracle
+			rm.BlockTime = cfg.blockTime
+			miners = append(miners, m)
+		}
+	}
+	return miners
+}
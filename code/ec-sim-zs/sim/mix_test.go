@@ -0,0 +1,75 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRoles(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		miners    int
+		honest    float64
+		adversary float64
+		mix       string
+		wantErr   bool
+	}{
+		{"no roles", 10, 0, 0, "", false},
+		{"all honest", 10, 1, 0, "", false},
+		{"all adversaries", 10, 0, 1, "", false},
+		{"split", 10, 0.6, 0.4, "", false},
+		{"one overlap", 10, 0.6, 0.5, "", true},
+		{"all overlap", 10, 1, 1, "", true},
+		// rounded down to 3 honest miners and 6 adversaries
+		{"rounded", 10, 0.35, 0.65, "", false},
+		{"mix", 4, 0, 0.5, "honest:1,rational:1", false},
+		{"mix overlap", 4, 0, 0.5, "honest:3,rational:1", true},
+		// the mix overrides -honest
+		{"mix without honest", 4, 1, 0.5, "rational:1", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &simConfig{totalMiners: tc.miners, honestFrac: tc.honest, adversaryFrac: tc.adversary}
+			if tc.mix != "" {
+				var err error
+				if cfg.mix, err = parseStrategyMix(tc.mix); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := cfg.checkRoles()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("checkRoles() = %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseStrategyMix(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		// substring of the error, none if empty
+		want string
+	}{
+		{"rational:6,honest:2,balance:1,reorg:1", ""},
+		{"honest:1", ""},
+		{"rational:6,honest:2,selfish:1,balance:1", "strategy selfish is not supported"},
+		{"greedy:1", `unknown strategy "greedy"`},
+		{"honest", "must be of the form strategy:weight"},
+		{"honest:x", `invalid weight "x" for honest`},
+		{"honest:1,honest:2", "strategy honest given twice"},
+		{"honest:-1", "invalid weight -1 for honest"},
+		{"honest:0,rational:0", "mix needs a positive weight"},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			_, err := parseStrategyMix(tc.spec)
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("parseStrategyMix(%q) returned %v", tc.spec, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("parseStrategyMix(%q) returned %v, want an error with %q", tc.spec, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package sim
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// statsHeader lists the columns written by writeStats, in order:
+//
+//	trial       index of the trial in the suite
+//	miners      number of miners
+//	lbp         lookback parameter, or its schedule if it changed
+//	rounds      number of rounds simulated
+//	maxHeight   height of the last round
+//	blocks      non-null blocks mined, genesis included
+//	headWeight  weight of the final head tipset
+//	avgForks    average live forks per round
+//	orphans     non-null blocks outside the canonical chain
+var statsHeader = []string{"trial", "miners", "lbp", "rounds", "maxHeight", "blocks", "headWeight", "avgForks", "orphans"}
+
+// writeStats outputs a CSV file with one row of statistics per trial, the
+// first warmup heights of each left out of its metrics
+func writeStats(cts []*ChainTracker, path string, warmup int) {
+	sw := newStatsWriter(path, warmup)
+	for i, ct := range cts {
+		sw.write(i, ct)
+	}
+	sw.close()
+}
+
+// statsWriter writes the rows of writeStats one trial at a time
+type statsWriter struct {
+	fil    *os.File
+	w      *csv.Writer
+	warmup int
+}
+
+// newStatsWriter creates the CSV file at path and writes its header
+func newStatsWriter(path string, warmup int) *statsWriter {
+	reportf("Writing Stats %s\n", path)
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			panic(err)
+		}
+	}
+
+	fil, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	w := csv.NewWriter(fil)
+	if err := w.Write(statsHeader); err != nil {
+		panic(err)
+	}
+	return &statsWriter{fil: fil, w: w, warmup: warmup}
+}
+
+// write writes the row of trial i
+func (sw *statsWriter) write(i int, ct *ChainTracker) {
+	row := []string{
+		strconv.Itoa(i),
+		strconv.Itoa(len(ct.miners)),
+		ct.lbps.String(),
+		strconv.Itoa(ct.maxHeight + 1),
+		strconv.Itoa(ct.maxHeight),
+		strconv.Itoa(liveBlockCount(ct)),
+		strconv.Itoa(ct.head.Weight),
+		strconv.FormatFloat(averageLiveForksPerRound(ct, sw.warmup), 'f', -1, 64),
+		strconv.Itoa(orphanCount(ct, sw.warmup)),
+	}
+	if err := sw.w.Write(row); err != nil {
+		panic(err)
+	}
+}
+
+func (sw *statsWriter) close() {
+	sw.w.Flush()
+	if err := sw.w.Error(); err != nil {
+		panic(err)
+	}
+	if err := sw.fil.Close(); err != nil {
+		panic(err)
+	}
+}
+
+// canonicalTipset is a tipset of the canonical chain as written by
+// writeCanonicalChain; owners are listed in the order of the blocks
+type canonicalTipset struct {
+	Height int   `json:"height"`
+	Blocks []int `json:"blocks"`
+	Owners []int `json:"owners"`
+	Weight int   `json:"weight"`
+}
+
+// writeCanonicalChain outputs the canonical chain as a JSON array with one
+// tipset per height, genesis first, leaving out orphans and null tipsets.
+// Blocks are in tipset order, i.e. sorted by ticket.  In a pruned chain the
+// array starts at the oldest tipset kept.
+func writeCanonicalChain(ct *ChainTracker, path string) {
+	reportf("Writing Canonical Chain %s\n", path)
+
+	ts := ct.head
+	if ts.Blocks[0].Null {
+		ts = ts.Blocks[0].liveParents()
+	}
+	var tipsets []canonicalTipset
+	for {
+		cts := canonicalTipset{Height: ts.getHeight(), Weight: ts.Weight}
+		for _, blk := range ts.Blocks {
+			cts.Blocks = append(cts.Blocks, blk.Nonce)
+			cts.Owners = append(cts.Owners, blk.Owner)
+		}
+		tipsets = append(tipsets, cts)
+		if ts.Blocks[0].Owner == -1 || ts.getHeight() <= ct.prunedBelow {
+			break
+		}
+		ts = ts.Blocks[0].liveParents()
+	}
+	// genesis first
+	for i, j := 0, len(tipsets)-1; i < j; i, j = i+1, j-1 {
+		tipsets[i], tipsets[j] = tipsets[j], tipsets[i]
+	}
+
+	marshalled, err := json.MarshalIndent(tipsets, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(path, marshalled, 0644); err != nil {
+		panic(err)
+	}
+}
+
+// drawChainSVG renders the chain straight to an svg by running the dot graph
+// written by drawChain through GraphViz.  If GraphViz isn't installed the .dot
+// file is left in place and a warning printed.
+func drawChainSVG(ct *ChainTracker, name string, outputDir string) {
+	drawChain(ct, name, outputDir)
+	dotToSVG(fmt.Sprintf("%s/%s.dot", outputDir, name), fmt.Sprintf("%s/%s.svg", outputDir, name))
+}
+
+// dotToSVG renders the dot graph at dotPath to svgPath with GraphViz and
+// removes the .dot file, or leaves it and prints a warning if GraphViz isn't
+// installed or fails.
+func dotToSVG(dotPath, svgPath string) {
+	if _, err := exec.LookPath("dot"); err != nil {
+		reportf("warning: GraphViz dot not found, leaving %s\n", dotPath)
+		return
+	}
+
+	out, err := exec.Command("dot", "-Tsvg", dotPath, "-o", svgPath).CombinedOutput()
+	if err != nil {
+		reportf("warning: dot failed (%s), leaving %s: %s\n", err, dotPath, out)
+		return
+	}
+	os.Remove(dotPath)
+}
+
+// renderChain draws the chain in the given format, "dot", "svg", "tipsets",
+// "gexf" or "mermaid", or exports its canonical chain as Filecoin tipsets for
+// "filecoin"
+func renderChain(ct *ChainTracker, name string, outputDir string, format string) {
+	switch format {
+	case "svg":
+		drawChainSVG(ct, name, outputDir)
+	case "tipsets":
+		drawTipsetDAG(ct, fmt.Sprintf("%s/%s.tipsets.dot", outputDir, name))
+	case "gexf":
+		writeGEXF(ct, fmt.Sprintf("%s/%s.gexf", outputDir, name))
+	case "mermaid":
+		writeMermaid(ct, fmt.Sprintf("%s/%s.mmd", outputDir, name))
+	case "filecoin":
+		writeFilecoinFormat(ct, fmt.Sprintf("%s/%s.filecoin.json", outputDir, name))
+	default:
+		drawChain(ct, name, outputDir)
+	}
+}
@@ -0,0 +1,99 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// forkOverlay aggregates the shape of many trials run with the same
+// parameters: forkHistogram summed over the trials, and how often a height
+// with each number of live blocks was followed by one with each other number.
+type forkOverlay struct {
+	trials int
+	// widths maps a number of live blocks at a height to the number of
+	// heights with that many, over all trials
+	widths map[int]int
+	// follows[[2]int{w, next}] is the number of heights with w live blocks
+	// followed by a height with next
+	follows map[[2]int]int
+}
+
+// newForkOverlay aggregates the heights of cts past the warmup
+func newForkOverlay(cts []*ChainTracker, warmup int) *forkOverlay {
+	ov := &forkOverlay{trials: len(cts), widths: make(map[int]int), follows: make(map[[2]int]int)}
+	for _, ct := range cts {
+		for w, n := range forkHistogram(ct, warmup) {
+			ov.widths[w] += n
+		}
+		for h := ct.firstMeasured(warmup); h < ct.maxHeight; h++ {
+			ov.follows[[2]int{len(ct.liveBlocksByHeight[h]), len(ct.liveBlocksByHeight[h+1])}]++
+		}
+	}
+	return ov
+}
+
+// drawForkOverlay outputs a dot graph of the overlay: a node for each number
+// of live blocks seen at a height, labelled with how often it was seen, and
+// an edge from each width to the widths following it, thicker the more often
+// it did.  Heights without live blocks are stalls.
+func drawForkOverlay(ov *forkOverlay, path string) {
+	reportf("Drawing Fork Overlay %s\n", path)
+
+	fil, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer fil.Close()
+
+	widths := make([]int, 0, len(ov.widths))
+	total := 0
+	for w, n := range ov.widths {
+		widths = append(widths, w)
+		total += n
+	}
+	sort.Ints(widths)
+
+	edges := make([][2]int, 0, len(ov.follows))
+	maxFollows := 0
+	for e, n := range ov.follows {
+		edges = append(edges, e)
+		if n > maxFollows {
+			maxFollows = n
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+
+	fmt.Fprintln(fil, "digraph G {")
+	fmt.Fprintf(fil, "\tlabel=\"live blocks per height over %d trials\";\n", ov.trials)
+	fmt.Fprintln(fil, "\tnode [shape=circle];")
+	for _, w := range widths {
+		n := ov.widths[w]
+		label := fmt.Sprintf("%d live", w)
+		if w == 0 {
+			label = "stall"
+		}
+		fmt.Fprintf(fil, "\tw%d [label=\"%s\\n%d heights (%.1f%%)\"];\n", w, label, n, 100*float64(n)/float64(total))
+	}
+	for _, e := range edges {
+		n := ov.follows[e]
+		fmt.Fprintf(fil, "\tw%d -> w%d [label=\"%d\", penwidth=%.2f];\n", e[0], e[1], n, 1+9*float64(n)/float64(maxFollows))
+	}
+	fmt.Fprintln(fil, "}")
+}
+
+// renderForkOverlay draws the overlay of cts past the warmup as
+// name.overlay.dot in outputDir, or renders it to name.overlay.svg for the
+// svg format.
+func renderForkOverlay(cts []*ChainTracker, warmup int, name string, outputDir string, format string) {
+	dotPath := fmt.Sprintf("%s/%s.overlay.dot", outputDir, name)
+	drawForkOverlay(newForkOverlay(cts, warmup), dotPath)
+	if format == "svg" {
+		dotToSVG(dotPath, fmt.Sprintf("%s/%s.overlay.svg", outputDir, name))
+	}
+}
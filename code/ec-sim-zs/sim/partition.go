@@ -0,0 +1,191 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PartitionSchedule splits miners into groups that can't see each other's
+// blocks during a range of rounds.  Blocks mined in round r are delivered in
+// round r+1, so blocks mined during the partition reach the other groups on
+// the first round after it heals.
+type PartitionSchedule struct {
+	// group of each listed miner; unlisted miners share the default group ""
+	groups map[int]string
+	// first and last rounds (inclusive) of the partition
+	start, end int
+}
+
+// parsePartition parses a spec of the form "A:0-4,B:5-9@round50-100", giving
+// for each group the range of miner IDs it contains and, after the @, the
+// rounds during which the partition holds.
+func parsePartition(spec string) (*PartitionSchedule, error) {
+	parts := strings.Split(spec, "@")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("partition %q must be of the form groups@roundX-Y", spec)
+	}
+
+	start, end, err := parseRange(strings.TrimPrefix(parts[1], "round"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid partition rounds: %s", err)
+	}
+
+	ps := &PartitionSchedule{
+		groups: make(map[int]string),
+		start:  start,
+		end:    end,
+	}
+	for _, g := range strings.Split(parts[0], ",") {
+		kv := strings.Split(g, ":")
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("partition group %q must be of the form name:X-Y", g)
+		}
+		lo, hi, err := parseRange(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid miners for group %s: %s", kv[0], err)
+		}
+		for id := lo; id <= hi; id++ {
+			if other, ok := ps.groups[id]; ok {
+				return nil, fmt.Errorf("miner %d is in both group %s and %s", id, other, kv[0])
+			}
+			ps.groups[id] = kv[0]
+		}
+	}
+	return ps, nil
+}
+
+// parseRange parses an inclusive "X-Y" range (or a single "X").
+func parseRange(s string) (int, int, error) {
+	bounds := strings.Split(s, "-")
+	if len(bounds) > 2 {
+		return 0, 0, fmt.Errorf("bad range %q", s)
+	}
+	lo, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	hi := lo
+	if len(bounds) == 2 {
+		if hi, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if lo < 0 || hi < lo {
+		return 0, 0, fmt.Errorf("bad range %q", s)
+	}
+	return lo, hi, nil
+}
+
+// splits returns whether the blocks delivered in the given round are split
+// between groups, i.e. were mined while the partition held.  Blocks
+// delivered in its first round were mined before it and reach everyone, as
+// do those mined in its last round, which are delivered once it heals.  A
+// nil schedule never splits.
+func (ps *PartitionSchedule) splits(round int) bool {
+	return ps != nil && round > ps.start && round <= ps.end
+}
+
+// group returns the name of the group a miner belongs to.
+func (ps *PartitionSchedule) group(minerID int) string {
+	return ps.groups[minerID]
+}
+
+// deliver returns, for every group, the blocks from the previous round that
+// its miners receive in this round.  Unless the round splits them, every
+// miner gets every block, under the default group "".
+func (ps *PartitionSchedule) deliver(round int, blocks []*Block) map[string][]*Block {
+	if !ps.splits(round) {
+		return map[string][]*Block{"": blocks}
+	}
+
+	delivered := make(map[string][]*Block)
+	for _, g := range ps.groups {
+		delivered[g] = nil
+	}
+	delivered[""] = nil
+	for _, blk := range blocks {
+		g := ps.group(blk.Owner)
+		delivered[g] = append(delivered[g], blk)
+	}
+	return delivered
+}
+
+// minersByHead groups miners by the head tipset in their view of the chain.
+// A head that reached a miner late counts as the tipset it extends with its
+// null blocks.
+func minersByHead(ct *ChainTracker) map[string][]int {
+	heads := make(map[string][]int)
+	for _, m := range ct.miners {
+		head := ct.headFor(m.ID())
+		if head.Blocks[0].Null {
+			head = head.Blocks[0].liveParents()
+		}
+		name := head.Name
+		heads[name] = append(heads[name], m.ID())
+	}
+	return heads
+}
+
+// reportHeadAgreement prints whether all miners ended up on the same head.
+func reportHeadAgreement(ct *ChainTracker) {
+	heads := minersByHead(ct)
+	names := make([]string, 0, len(heads))
+	for name := range heads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(heads) == 1 {
+		reportf("all %d miners agree on head %s\n", len(ct.miners), names[0])
+		return
+	}
+	reportf("miners disagree: %d distinct heads\n", len(heads))
+	for _, name := range names {
+		reportf("\t%s: miners %v\n", name, heads[name])
+	}
+}
+
+// headAgreement returns the number of distinct heads in the miners' views of
+// the chain at the end of round: 1 when the network agrees, more while
+// partitions or delays keep miners apart.  Rounds that weren't recorded,
+// e.g. of a chain saved before the series was, give 0.
+func (ct *ChainTracker) headAgreement(round int) int {
+	if round < 0 || round >= len(ct.distinctHeads) {
+		return 0
+	}
+	return ct.distinctHeads[round]
+}
+
+// convergenceDelay returns the number of rounds after the partition ps
+// healed before all miners agreed on a head again, or -1 if they never did.
+func convergenceDelay(ct *ChainTracker, ps *PartitionSchedule) int {
+	for round := ps.end + 1; round < len(ct.distinctHeads); round++ {
+		if ct.headAgreement(round) == 1 {
+			return round - ps.end
+		}
+	}
+	return -1
+}
+
+// printHeadAgreement prints the number of distinct heads over the run as
+// runs of rounds sharing a count, and how long after the partition ps healed
+// the miners converged.
+func printHeadAgreement(ct *ChainTracker, ps *PartitionSchedule) {
+	var runs []string
+	for start, round := 0, 1; round <= len(ct.distinctHeads); round++ {
+		if round < len(ct.distinctHeads) && ct.distinctHeads[round] == ct.distinctHeads[start] {
+			continue
+		}
+		runs = append(runs, fmt.Sprintf("%d (rounds %d-%d)", ct.distinctHeads[start], start, round-1))
+		start = round
+	}
+	reportf("distinct heads per round: %s\n", strings.Join(runs, ", "))
+
+	if delay := convergenceDelay(ct, ps); delay >= 0 {
+		reportf("miners agreed on a head %d rounds after the partition healed\n", delay)
+	} else {
+		reportln("miners had not agreed on a head by the end of the run")
+	}
+}
@@ -0,0 +1,44 @@
+package sim
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPartitionDeliver(t *testing.T) {
+	ps, err := parsePartition("A:0-1,B:2-3@round3-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []*Block{{Nonce: 1, Owner: 0}, {Nonce: 2, Owner: 2}, {Nonce: 3, Owner: 3}}
+
+	for _, tc := range []struct {
+		round int
+		// nonces each group receives
+		want map[string]string
+	}{
+		{2, map[string]string{"": "[1 2 3]"}},
+		// mined in round 2, before the partition
+		{3, map[string]string{"": "[1 2 3]"}},
+		{4, map[string]string{"": "[]", "A": "[1]", "B": "[2 3]"}},
+		{5, map[string]string{"": "[]", "A": "[1]", "B": "[2 3]"}},
+		// mined in the partition's last round, delivered once it heals
+		{6, map[string]string{"": "[1 2 3]"}},
+	} {
+		t.Run(fmt.Sprint("round", tc.round), func(t *testing.T) {
+			delivered := ps.deliver(tc.round, blocks)
+			if len(delivered) != len(tc.want) {
+				t.Fatalf("delivered to %d groups, want %d", len(delivered), len(tc.want))
+			}
+			for g, want := range tc.want {
+				var nonces []int
+				for _, blk := range delivered[g] {
+					nonces = append(nonces, blk.Nonce)
+				}
+				if got := fmt.Sprint(nonces); got != want {
+					t.Errorf("group %q got %s, want %s", g, got, want)
+				}
+			}
+		})
+	}
+}
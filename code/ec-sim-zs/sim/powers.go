@@ -0,0 +1,124 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// tolerance on the sum of miner powers
+const powerEpsilon = 1e-6
+
+// shape parameter of the pareto power distribution (the 80/20 rule)
+const paretoAlpha = 1.16
+
+// assignPowers returns the power of each miner described by spec, which is
+// either empty (uniform 1/N), a distribution name ("zipf" or "pareto") or a
+// comma-separated list of totalMiners powers summing to 1.
+func assignPowers(totalMiners int, spec string) ([]float64, error) {
+	if totalMiners <= 0 {
+		return nil, fmt.Errorf("need at least one miner, got %d", totalMiners)
+	}
+
+	powers := make([]float64, totalMiners)
+	switch spec {
+	case "", "uniform":
+		for i := range powers {
+			powers[i] = 1.0 / float64(totalMiners)
+		}
+		return powers, nil
+	case "zipf":
+		// the i-th largest miner has power proportional to 1/i
+		for i := range powers {
+			powers[i] = 1.0 / float64(i+1)
+		}
+		return normalizePowers(powers), nil
+	case "pareto":
+		// deterministic quantiles of a pareto distribution, largest first
+		for i := range powers {
+			u := (float64(i) + 0.5) / float64(totalMiners)
+			powers[i] = math.Pow(u, -1/paretoAlpha)
+		}
+		return normalizePowers(powers), nil
+	}
+
+	fields := strings.Split(spec, ",")
+	if len(fields) != totalMiners {
+		return nil, fmt.Errorf("got %d powers for %d miners", len(fields), totalMiners)
+	}
+	var sum float64
+	for i, f := range fields {
+		p, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid power %q for miner %d: %s", f, i, err)
+		}
+		if p < 0 {
+			return nil, fmt.Errorf("negative power %f for miner %d", p, i)
+		}
+		powers[i] = p
+		sum += p
+	}
+	if math.Abs(sum-1) > powerEpsilon {
+		return nil, fmt.Errorf("powers sum to %f, not 1", sum)
+	}
+	return powers, nil
+}
+
+// minerPowers returns the power of each miner described by spec as in
+// assignPowers, or, for hash rates, the comma-separated absolute hash rate of
+// each of totalMiners miners along with the fractions of network power they
+// normalize to.  Rates are nil unless hashRates is set.
+func minerPowers(totalMiners int, spec string, hashRates bool) (powers, rates []float64, err error) {
+	if !hashRates {
+		powers, err = assignPowers(totalMiners, spec)
+		return powers, nil, err
+	}
+
+	if spec == "" {
+		return nil, nil, fmt.Errorf("no hash rates given")
+	}
+	fields := strings.Split(spec, ",")
+	if len(fields) != totalMiners {
+		return nil, nil, fmt.Errorf("got %d hash rates for %d miners", len(fields), totalMiners)
+	}
+	rates = make([]float64, totalMiners)
+	var sum float64
+	for i, f := range fields {
+		r, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid hash rate %q for miner %d: %s", f, i, err)
+		}
+		if r < 0 {
+			return nil, nil, fmt.Errorf("negative hash rate %f for miner %d", r, i)
+		}
+		rates[i] = r
+		sum += r
+	}
+	if sum <= 0 {
+		return nil, nil, fmt.Errorf("hash rates sum to %f, must be positive", sum)
+	}
+	powers = normalizePowers(append([]float64(nil), rates...))
+	return powers, rates, nil
+}
+
+// printHashRates reports each miner's absolute hash rate and the share of
+// network power it wins elections with
+func printHashRates(rates, powers []float64) {
+	reportln("miner hash rates:")
+	for id, r := range rates {
+		reportf("\tminer %d: %g (%.2f%% of power)\n", id, r, 100*powers[id])
+	}
+}
+
+// normalizePowers scales powers in place so that they sum to 1.
+func normalizePowers(powers []float64) []float64 {
+	var sum float64
+	for _, p := range powers {
+		sum += p
+	}
+	for i := range powers {
+		powers[i] /= sum
+	}
+	return powers
+}
@@ -0,0 +1,60 @@
+package sim
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// how often progress is reported during suite runs
+const progressInterval = 3 * time.Second
+
+// progress tracks completed trials of a suite and periodically reports the
+// percentage done and estimated time remaining
+type progress struct {
+	total int64
+	done  int64
+	start time.Time
+	stop  chan struct{}
+}
+
+func newProgress(total int) *progress {
+	return &progress{
+		total: int64(total),
+		start: time.Now(),
+		stop:  make(chan struct{}),
+	}
+}
+
+// finish marks one more trial as completed
+func (p *progress) finish() {
+	atomic.AddInt64(&p.done, 1)
+}
+
+// run prints progress every interval until close is called
+func (p *progress) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reportln(p.String())
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *progress) close() {
+	close(p.stop)
+}
+
+func (p *progress) String() string {
+	done := atomic.LoadInt64(&p.done)
+	elapsed := time.Since(p.start)
+	if done == 0 {
+		return fmt.Sprintf("progress: 0/%d trials, elapsed %s", p.total, elapsed.Round(time.Second))
+	}
+	remaining := time.Duration(float64(elapsed) / float64(done) * float64(p.total-done))
+	return fmt.Sprintf("progress: %d/%d trials (%.0f%%), ETA %s", done, p.total, 100*float64(done)/float64(p.total), remaining.Round(time.Second))
+}
@@ -0,0 +1,166 @@
+package sim
+
+import (
+	"runtime"
+)
+
+// prune bounds the chain tracker's memory by taking the live canonical
+// tipset depth heights below the head as final.  Only that tipset and its
+// descendants are kept: blocks below it or on forks leaving the canonical
+// chain below it are dropped, along with private forks, honest miners' bases
+// and views built on them, and head snapshots of earlier rounds.  The
+// canonical chain below the tipset is no longer indexed, and is cut off
+// below the longest lookback from it, to the first live tipset, so that
+// lookbacks still find their tickets.  It returns the blocks of round that
+// are kept.
+func (ct *ChainTracker) prune(depth int, round []*Block) []*Block {
+	var final *Tipset
+	for ts := ct.head; ts.getHeight() > ct.prunedBelow; ts = ts.getParents() {
+		if !ts.Blocks[0].Null && ts.getHeight() <= ct.head.getHeight()-depth {
+			final = ts
+			break
+		}
+	}
+	if final == nil {
+		return round
+	}
+
+	// a live or null tipset descends from final if its live ancestry
+	// passes through it
+	kept := make(map[int]bool)
+	for _, blk := range final.Blocks {
+		kept[blk.Nonce] = true
+	}
+	descends := func(ts *Tipset) bool {
+		if ts.Blocks[0].Null {
+			ts = ts.Blocks[0].liveParents()
+		}
+		if ts.getHeight() == final.getHeight() {
+			return ts.Name == final.Name
+		}
+		return ts.getHeight() > final.getHeight() && kept[ts.Blocks[0].Nonce]
+	}
+
+	top := final.getHeight()
+	for h := range ct.liveBlocksByHeight {
+		if h < final.getHeight() {
+			delete(ct.liveBlocksByHeight, h)
+		} else if h > top {
+			top = h
+		}
+	}
+	ct.liveBlocksByHeight[final.getHeight()] = append([]*Block(nil), final.Blocks...)
+	for h := final.getHeight() + 1; h <= top; h++ {
+		var blocks []*Block
+		for _, blk := range ct.liveBlocksByHeight[h] {
+			if descends(blk.Parents) {
+				kept[blk.Nonce] = true
+				blocks = append(blocks, blk)
+			}
+		}
+		if len(blocks) > 0 {
+			ct.liveBlocksByHeight[h] = blocks
+		} else {
+			delete(ct.liveBlocksByHeight, h)
+		}
+	}
+	for h := range ct.attempts {
+		if h <= final.getHeight() {
+			delete(ct.attempts, h)
+		}
+	}
+	for h := range ct.wins {
+		if h <= final.getHeight() {
+			delete(ct.wins, h)
+		}
+	}
+	for nonce, blk := range ct.allBlocks {
+		if !kept[nonce] && (!blk.Null || !descends(blk.Parents)) {
+			delete(ct.allBlocks, nonce)
+		}
+	}
+
+	for _, m := range ct.miners {
+		rm := rationalMiner(m)
+		for name, ts := range rm.PrivateForks {
+			if !descends(ts) {
+				delete(rm.PrivateForks, name)
+			}
+		}
+		if hm, ok := m.(*HonestMiner); ok && hm.Base != nil && !descends(hm.Base) {
+			hm.Base = nil
+			hm.HeadName = ""
+		}
+	}
+	for id, view := range ct.views {
+		if !descends(view) {
+			delete(ct.views, id)
+		}
+	}
+
+	cut := lookbackTipset(final, ct.lbps.max()+1)
+	for cut.Blocks[0].Null {
+		cut = cut.getParents()
+	}
+	for _, blk := range cut.Blocks {
+		blk.Parents = nil
+	}
+	var timeline []HeadSnapshot
+	for _, snap := range ct.headTimeline {
+		// the head of an earlier round is below final
+		if snap.Round >= final.getHeight() {
+			timeline = append(timeline, snap)
+		}
+	}
+	ct.headTimeline = timeline
+	for _, fc := range ct.forkCounts {
+		if drop := final.getHeight() - fc.from; drop > 0 {
+			if drop > len(fc.series) {
+				drop = len(fc.series)
+			}
+			fc.series = append([]int(nil), fc.series[drop:]...)
+			fc.from += drop
+		}
+	}
+
+	ct.lookbacks = make(map[lookbackKey]*Tipset)
+	ct.ghost = nil
+	ct.prunedBelow = final.getHeight()
+
+	var blocks []*Block
+	for _, blk := range round {
+		if kept[blk.Nonce] {
+			blocks = append(blocks, blk)
+		}
+	}
+	return blocks
+}
+
+// sampleHeap records the heap in use if it is the most seen yet, and
+// returns whether it was.  Memory peaks just before the chain is pruned, and
+// at the end of the run.
+func (ct *ChainTracker) sampleHeap() bool {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapAlloc <= ct.peakHeap {
+		return false
+	}
+	ct.peakHeap = ms.HeapAlloc
+	return true
+}
+
+// pruneSampled prunes like prune, sampling the heap before.  When the heap
+// is the most seen yet, the blocks dropped are collected and the heap left
+// recorded too, so that the two show what pruning frees; collecting after
+// every prune would slow long runs down.
+func (ct *ChainTracker) pruneSampled(depth int, round []*Block) []*Block {
+	peak := ct.sampleHeap()
+	blocks := ct.prune(depth, round)
+	if peak {
+		runtime.GC()
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		ct.prunedHeap = ms.HeapAlloc
+	}
+	return blocks
+}
@@ -0,0 +1,57 @@
+package sim
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPruneBoundsChain(t *testing.T) {
+	for _, lbp := range []int{1, 4} {
+		t.Run(fmt.Sprint("lbp=", lbp), func(t *testing.T) {
+			const prune = 10
+			cfg := testConfig(t, 8, 300, lbp)
+			cfg.prune = prune
+			ct, err := runSim(cfg, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct.prunedBelow < 250 {
+				t.Fatalf("pruned below height %d, want the chain pruned near its head", ct.prunedBelow)
+			}
+
+			// the canonical chain below the oldest block kept reaches past
+			// every lookback from it, and stops soon after
+			oldest := ct.liveBlocksByHeight[ct.prunedBelow][0].Parents
+			for oldest.getParents() != nil {
+				oldest = oldest.getParents()
+			}
+			if reach := ct.prunedBelow - lbp; oldest.getHeight() > reach {
+				t.Errorf("canonical chain cut at height %d, above the lookback from height %d at %d", oldest.getHeight(), ct.prunedBelow, reach)
+			}
+			if oldest.getHeight() < ct.prunedBelow-prune-lbp {
+				t.Errorf("canonical chain kept down to height %d, pruned below %d", oldest.getHeight(), ct.prunedBelow)
+			}
+
+			for _, snap := range ct.headTimeline {
+				if snap.Round < ct.prunedBelow {
+					t.Fatalf("head of round %d kept, pruned below %d", snap.Round, ct.prunedBelow)
+				}
+			}
+			// the peak and mean cover every round, the series only those
+			// kept
+			fc := ct.forkCounts[0]
+			if fc == nil || fc.rounds != cfg.rounds {
+				t.Fatalf("private forks counted for %+v rounds, want %d", fc, cfg.rounds)
+			}
+			if fc.from != ct.prunedBelow || len(ct.privateForkSeries(0)) != cfg.rounds-ct.prunedBelow {
+				t.Errorf("private forks kept for %d rounds from %d, pruned below %d", len(ct.privateForkSeries(0)), fc.from, ct.prunedBelow)
+			}
+			if ct.peakHeap == 0 || ct.prunedHeap == 0 {
+				t.Errorf("heap sampled at %d before pruning and %d after", ct.peakHeap, ct.prunedHeap)
+			}
+			for _, err := range validateChain(ct) {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package sim
+
+import (
+	"math"
+	"sort"
+)
+
+// forkRateQuantiles are the quantiles of average live forks per round that
+// suites report
+var forkRateQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Quantiles estimates a fixed set of quantiles of a stream of values in
+// constant memory with the P² algorithm (Jain and Chlamtac, 1985), so that
+// suites of many trials needn't keep every trial's metrics around.
+type Quantiles struct {
+	estimators []*p2Estimator
+}
+
+// NewQuantiles returns an estimator of the quantiles qs, each in (0, 1)
+func NewQuantiles(qs ...float64) *Quantiles {
+	est := &Quantiles{}
+	for _, q := range qs {
+		est.estimators = append(est.estimators, newP2Estimator(q))
+	}
+	return est
+}
+
+// Add adds a value to the stream
+func (est *Quantiles) Add(x float64) {
+	for _, e := range est.estimators {
+		e.add(x)
+	}
+}
+
+// Count returns the number of values added
+func (est *Quantiles) Count() int {
+	if len(est.estimators) == 0 {
+		return 0
+	}
+	return est.estimators[0].count
+}
+
+// Quantile returns the estimate of quantile q, which must be one of those the
+// estimator was made with, or NaN if it isn't or no values were added.
+func (est *Quantiles) Quantile(q float64) float64 {
+	for _, e := range est.estimators {
+		if e.p == q {
+			return e.quantile()
+		}
+	}
+	return math.NaN()
+}
+
+// p2Estimator tracks a single quantile p with five markers: the minimum, the
+// maximum, p and two quantiles halfway to the extremes.  Marker heights are
+// adjusted with a piecewise parabolic fit as their positions drift from
+// where they should be.
+type p2Estimator struct {
+	p     float64
+	count int
+	// marker heights, actual positions (1-based), desired positions, and
+	// desired position increments per value
+	heights [5]float64
+	pos     [5]float64
+	desired [5]float64
+	incr    [5]float64
+}
+
+func newP2Estimator(p float64) *p2Estimator {
+	return &p2Estimator{
+		p:       p,
+		pos:     [5]float64{1, 2, 3, 4, 5},
+		desired: [5]float64{1, 1 + 2*p, 1 + 4*p, 3 + 2*p, 5},
+		incr:    [5]float64{0, p / 2, p, (1 + p) / 2, 1},
+	}
+}
+
+func (e *p2Estimator) add(x float64) {
+	// the first five values are the initial marker heights
+	if e.count < 5 {
+		e.heights[e.count] = x
+		e.count++
+		if e.count == 5 {
+			sort.Float64s(e.heights[:])
+		}
+		return
+	}
+	e.count++
+
+	// find the cell x falls in, extending the extremes if needed
+	var k int
+	switch {
+	case x < e.heights[0]:
+		e.heights[0] = x
+		k = 0
+	case x >= e.heights[4]:
+		e.heights[4] = x
+		k = 3
+	default:
+		for k = 0; k < 3 && x >= e.heights[k+1]; k++ {
+		}
+	}
+	for i := k + 1; i < 5; i++ {
+		e.pos[i]++
+	}
+	for i := range e.desired {
+		e.desired[i] += e.incr[i]
+	}
+
+	// move the middle markers that drifted a position or more
+	for i := 1; i <= 3; i++ {
+		d := e.desired[i] - e.pos[i]
+		if (d >= 1 && e.pos[i+1]-e.pos[i] > 1) || (d <= -1 && e.pos[i-1]-e.pos[i] < -1) {
+			s := math.Copysign(1, d)
+			h := e.parabolic(i, s)
+			if h <= e.heights[i-1] || h >= e.heights[i+1] {
+				h = e.linear(i, s)
+			}
+			e.heights[i] = h
+			e.pos[i] += s
+		}
+	}
+}
+
+// parabolic returns the height of marker i moved by s positions along the
+// parabola through it and its neighbours
+func (e *p2Estimator) parabolic(i int, s float64) float64 {
+	n, q := e.pos, e.heights
+	return q[i] + s/(n[i+1]-n[i-1])*((n[i]-n[i-1]+s)*(q[i+1]-q[i])/(n[i+1]-n[i])+
+		(n[i+1]-n[i]-s)*(q[i]-q[i-1])/(n[i]-n[i-1]))
+}
+
+// linear returns the height of marker i moved by s positions towards its
+// neighbour
+func (e *p2Estimator) linear(i int, s float64) float64 {
+	j := i + int(s)
+	return e.heights[i] + s*(e.heights[j]-e.heights[i])/(e.pos[j]-e.pos[i])
+}
+
+func (e *p2Estimator) quantile() float64 {
+	if e.count == 0 {
+		return math.NaN()
+	}
+	if e.count <= 5 {
+		// too few values for the markers to have moved: take the nearest
+		// rank
+		sorted := append([]float64(nil), e.heights[:e.count]...)
+		sort.Float64s(sorted)
+		rank := int(math.Ceil(e.p * float64(e.count)))
+		if rank < 1 {
+			rank = 1
+		}
+		return sorted[rank-1]
+	}
+	return e.heights[2]
+}
+
+// printQuantiles reports the estimates of est's quantiles, under label
+func printQuantiles(label string, est *Quantiles) {
+	reportf("%s percentiles (%d trials):", label, est.Count())
+	for i, e := range est.estimators {
+		if i > 0 {
+			reportf(",")
+		}
+		reportf(" p%g %f", 100*e.p, e.quantile())
+	}
+	reportln()
+}
@@ -0,0 +1,72 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestQuantilesKnownDistributions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, tc := range []struct {
+		name     string
+		sample   func() float64
+		quantile func(q float64) float64
+	}{
+		{"uniform", rng.Float64, func(q float64) float64 { return q }},
+		{"exponential", rng.ExpFloat64, func(q float64) float64 { return -math.Log(1 - q) }},
+		{"normal", rng.NormFloat64, func(q float64) float64 { return math.Sqrt2 * math.Erfinv(2*q-1) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			est := NewQuantiles(0.1, 0.5, 0.9, 0.99)
+			const samples = 100000
+			for i := 0; i < samples; i++ {
+				est.Add(tc.sample())
+			}
+			if n := est.Count(); n != samples {
+				t.Errorf("counted %d values, want %d", n, samples)
+			}
+			for _, q := range []float64{0.1, 0.5, 0.9, 0.99} {
+				// within 2% of the spread between the 1st and 99th
+				// percentiles
+				got, want := est.Quantile(q), tc.quantile(q)
+				if tol := 0.02 * (tc.quantile(0.99) - tc.quantile(0.01)); math.Abs(got-want) > tol {
+					t.Errorf("quantile %g estimated as %f, want %f", q, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestQuantilesFewValues(t *testing.T) {
+	for _, tc := range []struct {
+		values []float64
+		// p50 and p90
+		want string
+	}{
+		{nil, "[NaN NaN]"},
+		{[]float64{3}, "[3 3]"},
+		{[]float64{4, 1, 3}, "[3 4]"},
+		{[]float64{5, 1, 4, 2}, "[2 5]"},
+		{[]float64{5, 1, 4, 2, 3}, "[3 5]"},
+	} {
+		t.Run(fmt.Sprint(tc.values), func(t *testing.T) {
+			est := NewQuantiles(0.5, 0.9)
+			for _, x := range tc.values {
+				est.Add(x)
+			}
+			if got := fmt.Sprint([]float64{est.Quantile(0.5), est.Quantile(0.9)}); got != tc.want {
+				t.Errorf("quantiles %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestQuantileNotEstimated(t *testing.T) {
+	est := NewQuantiles(0.5)
+	est.Add(1)
+	if q := est.Quantile(0.9); !math.IsNaN(q) {
+		t.Errorf("quantile 0.9 of an estimator of 0.5 is %f, want NaN", q)
+	}
+}
@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// diffRuns returns an error describing the first structural difference
+// between two chains: blocks, owners, heights, parents and head must all
+// match, genesis tickets included
+func diffRuns(a, b *ChainTracker) error {
+	if len(a.allBlocks) != len(b.allBlocks) {
+		return fmt.Errorf("runs mined %d and %d blocks", len(a.allBlocks), len(b.allBlocks))
+	}
+	nonces := make([]int, 0, len(a.allBlocks))
+	for nonce := range a.allBlocks {
+		nonces = append(nonces, nonce)
+	}
+	sort.Ints(nonces)
+	for _, nonce := range nonces {
+		blkA, blkB := a.allBlocks[nonce], b.allBlocks[nonce]
+		if blkB == nil {
+			return fmt.Errorf("block %d is missing from the second run", nonce)
+		}
+		if blkA.Owner != blkB.Owner || blkA.Height != blkB.Height || blkA.Null != blkB.Null || blkA.Seed != blkB.Seed {
+			return fmt.Errorf("block %d differs: owner %d/%d, height %d/%d, null %t/%t, ticket %d/%d", nonce,
+				blkA.Owner, blkB.Owner, blkA.Height, blkB.Height, blkA.Null, blkB.Null, blkA.Seed, blkB.Seed)
+		}
+		if parentName(blkA) != parentName(blkB) {
+			return fmt.Errorf("block %d has parents %s and %s", nonce, parentName(blkA), parentName(blkB))
+		}
+	}
+	if a.head.Name != b.head.Name {
+		return fmt.Errorf("heads differ: %s and %s", a.head.Name, b.head.Name)
+	}
+	return nil
+}
+
+func TestRunSimReproducible(t *testing.T) {
+	must := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		set  func(cfg *simConfig)
+	}{
+		{"rational", func(cfg *simConfig) {}},
+		{"honest", func(cfg *simConfig) { cfg.honestFrac = 0.5 }},
+		{"balance attack", func(cfg *simConfig) {
+			cfg.attack = "balance"
+			cfg.adversaryFrac = 0.25
+		}},
+		{"reorg attack", func(cfg *simConfig) {
+			cfg.attack = "reorg"
+			cfg.adversaryFrac = 0.25
+			cfg.reorgDepth = 2
+		}},
+		{"mix", func(cfg *simConfig) {
+			var err error
+			cfg.mix, err = parseStrategyMix("rational:2,honest:1,balance:1")
+			must(err)
+		}},
+		{"poisson election", func(cfg *simConfig) { cfg.election = poissonElection }},
+		{"lookback schedule", func(cfg *simConfig) {
+			var err error
+			cfg.lbps, err = parseLBPSchedule("1@0,4@20", 1)
+			must(err)
+		}},
+		{"partition", func(cfg *simConfig) {
+			var err error
+			cfg.partitions, err = parsePartition("A:0-3,B:4-7@round10-20")
+			must(err)
+		}},
+		{"churn", func(cfg *simConfig) {
+			var err error
+			cfg.churn, err = parseChurn("miner2@leave10,miner2@join25,miner6@join15")
+			must(err)
+		}},
+		{"capped ghost", func(cfg *simConfig) {
+			cfg.forkChoice = ghostChoice
+			cfg.maxTipsetSize = 2
+			cfg.weight = "log"
+		}},
+		{"power tiebreak", func(cfg *simConfig) {
+			var err error
+			cfg.tieBreaker, err = parseTieBreaker("powerCoin")
+			must(err)
+		}},
+		{"adaptive difficulty", func(cfg *simConfig) { cfg.difficulty = adaptiveDifficulty }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(t, 8, 40, 3)
+			tc.set(cfg)
+			dir := t.TempDir()
+			var runs [2]*ChainTracker
+			var saved [2][]byte
+			for i := range runs {
+				var err error
+				if runs[i], err = runSim(cfg, 5); err != nil {
+					t.Fatal(err)
+				}
+				name := fmt.Sprint("run", i)
+				writeChain(runs[i], name, dir)
+				if saved[i], err = os.ReadFile(filepath.Join(dir, name+".json")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := diffRuns(runs[0], runs[1]); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(saved[0], saved[1]) {
+				t.Error("runs with the same seed wrote different chains")
+			}
+		})
+	}
+}
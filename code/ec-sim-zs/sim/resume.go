@@ -0,0 +1,87 @@
+package sim
+
+import "fmt"
+
+// rationalMiner returns the RationalMiner underlying any of the built-in
+// strategies.
+func rationalMiner(m Miner) *RationalMiner {
+	switch m := m.(type) {
+	case *RationalMiner:
+		return m
+	case *HonestMiner:
+		return m.RationalMiner
+	case *BalanceAttacker:
+		return m.RationalMiner
+	case *ReorgAttacker:
+		return m.RationalMiner
+	}
+	panic(fmt.Sprintf("unknown miner strategy %T", m))
+}
+
+// resumeSim continues a chain loaded with loadChain for rounds more rounds,
+// with the miners, private forks and undelivered blocks it was saved with.
+// The chain keeps the lookback schedule it was saved with; the remaining
+// parameters come from cfg.  Miners' views of the head aren't saved, so every miner
+// resumes on the network's head, and neither are blocks still on their way
+// through a topology.  It returns an error if the chain breaks one
+// of the invariants the simulation relies on.
+func resumeSim(cfg simConfig, ct *ChainTracker, rounds int, seed int64) error {
+	cfg.lbps = ct.lbps
+	// renormalize churn from the powers the chain was saved with
+	cfg.powers = make([]float64, len(ct.miners))
+	for _, m := range ct.miners {
+		cfg.powers[m.ID()] = m.Power()
+	}
+	ct.blockReward = cfg.blockReward
+	ct.txPerBlock = cfg.txPerBlock
+	ct.slashPenalty = cfg.slashPenalty
+	ct.blockTime = cfg.blockTime
+	ct.tieBreaker = cfg.tieBreaker(ct.miners)
+	ct.forkChoice = cfg.forkChoice
+	ct.countDisagreements = cfg.disagreements
+	ct.verbosity = cfg.verbosity
+	ct.strict = cfg.strict
+	ct.topology = cfg.buildTopology(len(ct.miners), seed)
+	for _, m := range ct.miners {
+		rm := rationalMiner(m)
+		rm.Rand = minerRand(seed, rm.MinerID)
+		rm.Election = cfg.election
+		rm.Oracle = cfg.oracle
+		rm.BlockTime = cfg.blockTime
+		if _, ok := m.(*RationalMiner); ok {
+			rm.MaxForks = cfg.maxForks
+			rm.Risk = cfg.risk
+		}
+	}
+
+	// carry on numbering blocks where the saved chain left off
+	for nonce := range ct.allBlocks {
+		if nonce >= ct.nextNonce {
+			ct.nextNonce = nonce + 1
+		}
+	}
+	for _, blk := range ct.pending {
+		if blk.Nonce >= ct.nextNonce {
+			ct.nextNonce = blk.Nonce + 1
+		}
+	}
+
+	from := ct.maxHeight + 1
+	// chains saved without head agreement leave their rounds unrecorded
+	for len(ct.distinctHeads) < from {
+		ct.distinctHeads = append(ct.distinctHeads, 0)
+	}
+	pending, err := runRounds(&cfg, ct, seed, ct.pending, from, from+rounds)
+	if err != nil {
+		return err
+	}
+	ct.pending = pending
+	ct.maxHeight = from + rounds - 1
+	if err := verifyHeadConsistency(ct); err != nil {
+		return err
+	}
+	if cfg.strict {
+		return verifyWeightMonotonic(ct)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package sim
+
+import (
+	"math"
+	"sort"
+)
+
+// minerEarnings returns the block rewards earned by each miner, less the
+// penalties for its slashable equivocations.  Only blocks in the canonical
+// chain are rewarded; orphaned blocks earn nothing.
+func minerEarnings(ct *ChainTracker) map[int]float64 {
+	earnings := make(map[int]float64)
+	for _, m := range ct.miners {
+		earnings[m.ID()] = 0
+	}
+	for nonce := range headAncestry(ct) {
+		blk := ct.allBlocks[nonce]
+		if blk.Owner == -1 {
+			continue
+		}
+		earnings[blk.Owner] += ct.blockReward
+	}
+	for _, ev := range slashingDetector(ct) {
+		earnings[ev.Miner] -= ct.slashPenalty
+	}
+	return earnings
+}
+
+// earningsToPower returns, for each miner, its share of all rewards divided
+// by its share of power.  In a fair protocol these ratios are close to 1.
+func earningsToPower(ct *ChainTracker) map[int]float64 {
+	earnings := minerEarnings(ct)
+	var total float64
+	for _, e := range earnings {
+		total += e
+	}
+
+	ratios := make(map[int]float64)
+	for _, m := range ct.miners {
+		if total == 0 || m.Power() == 0 {
+			continue
+		}
+		ratios[m.ID()] = earnings[m.ID()] / total / m.Power()
+	}
+	return ratios
+}
+
+// printEarningsRatios prints each miner's earnings to power ratio averaged
+// over all trials.
+func printEarningsRatios(cts []*ChainTracker) {
+	perMiner := make(map[int][]float64)
+	for _, ct := range cts {
+		for id, r := range earningsToPower(ct) {
+			perMiner[id] = append(perMiner[id], r)
+		}
+	}
+
+	ids := make([]int, 0, len(perMiner))
+	for id := range perMiner {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	reportln("earnings to power ratios:")
+	for _, id := range ids {
+		mean, _ := meanAndVariance(perMiner[id])
+		reportf("\tminer %d: %f\n", id, mean)
+	}
+}
+
+// canonicalBlockCounts returns the number of blocks each miner has in the
+// canonical chain, genesis left out.
+func canonicalBlockCounts(ct *ChainTracker) map[int]int {
+	counts := make(map[int]int)
+	for nonce := range headAncestry(ct) {
+		if blk := ct.allBlocks[nonce]; blk.Owner != -1 {
+			counts[blk.Owner]++
+		}
+	}
+	return counts
+}
+
+// nakamotoCoefficient returns the smallest number of miners that together
+// mined more than half of the canonical chain, or 0 if it has no mined
+// blocks.
+func nakamotoCoefficient(ct *ChainTracker) int {
+	counts := canonicalBlockCounts(ct)
+	shares := make([]int, 0, len(counts))
+	total := 0
+	for _, c := range counts {
+		shares = append(shares, c)
+		total += c
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(shares)))
+
+	sum := 0
+	for i, c := range shares {
+		sum += c
+		if 2*sum > total {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// giniSeries returns the Gini coefficient of the miners' shares of the
+// canonical blocks in every window of window consecutive heights past the
+// warmup, oldest first: 0 when all miners own as many blocks, approaching 1
+// as one miner owns them all.  Unlike the Nakamoto coefficient it follows
+// concentration over the run.
+func giniSeries(ct *ChainTracker, window, warmup int) []float64 {
+	if window <= 0 {
+		return nil
+	}
+	owners := make(map[int][]int)
+	for nonce := range headAncestry(ct) {
+		if blk := ct.allBlocks[nonce]; blk.Owner >= 0 && blk.Owner < len(ct.miners) {
+			owners[blk.Height] = append(owners[blk.Height], blk.Owner)
+		}
+	}
+
+	counts := make([]float64, len(ct.miners))
+	var series []float64
+	first := ct.firstMeasured(warmup)
+	for h := first; h <= ct.maxHeight; h++ {
+		for _, o := range owners[h] {
+			counts[o]++
+		}
+		if h-window >= first {
+			for _, o := range owners[h-window] {
+				counts[o]--
+			}
+		}
+		if h-first+1 >= window {
+			series = append(series, gini(counts))
+		}
+	}
+	return series
+}
+
+// gini returns the Gini coefficient of values, 0 if they sum to 0
+func gini(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := float64(len(sorted))
+	var sum, weighted float64
+	for i, v := range sorted {
+		sum += v
+		weighted += (2*float64(i+1) - n - 1) * v
+	}
+	if sum == 0 {
+		return 0
+	}
+	return weighted / (n * sum)
+}
+
+// trend returns the least squares slope of series against its index
+func trend(series []float64) float64 {
+	n := float64(len(series))
+	if n < 2 {
+		return 0
+	}
+	var sx, sy, sxx, sxy float64
+	for i, y := range series {
+		x := float64(i)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	return (n*sxy - sx*sy) / (n*sxx - sx*sx)
+}
+
+// fairnessAlpha is the significance level at which fairnessTest's p-value
+// rejects block production proportional to power
+const fairnessAlpha = 0.05
+
+// fairnessTest runs a chi-squared goodness-of-fit test of the owners of the
+// canonical chain's blocks against the miners' powers, returning the
+// statistic and its p-value.  Miners without power are left out, as no
+// blocks are expected of them.  A chain with fewer than two powered miners
+// or no blocks can't be tested and gets a p-value of 1.
+func fairnessTest(ct *ChainTracker, powers []float64) (chiSq float64, pValue float64) {
+	counts := make([]float64, len(powers))
+	n := 0.0
+	for owner, c := range canonicalBlockCounts(ct) {
+		if owner >= len(powers) || powers[owner] <= 0 {
+			continue
+		}
+		counts[owner] += float64(c)
+		n += float64(c)
+	}
+
+	var total float64
+	categories := 0
+	for _, p := range powers {
+		if p > 0 {
+			total += p
+			categories++
+		}
+	}
+	if categories < 2 || n == 0 {
+		return 0, 1
+	}
+
+	for id, p := range powers {
+		if p <= 0 {
+			continue
+		}
+		expected := n * p / total
+		chiSq += (counts[id] - expected) * (counts[id] - expected) / expected
+	}
+	return chiSq, chiSquaredSurvival(chiSq, categories-1)
+}
+
+// chiSquaredSurvival returns P(X >= x) for X chi-squared distributed with df
+// degrees of freedom, the regularized upper incomplete gamma Q(df/2, x/2).
+func chiSquaredSurvival(x float64, df int) float64 {
+	if x <= 0 {
+		return 1
+	}
+	a, x := float64(df)/2, x/2
+	lgam, _ := math.Lgamma(a)
+	norm := math.Exp(a*math.Log(x) - x - lgam)
+
+	// series for P(a, x) converges quickly below a+1, the continued
+	// fraction for Q(a, x) above it
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < 1000; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if term < sum*1e-15 {
+				break
+			}
+		}
+		return math.Max(0, 1-sum*norm)
+	}
+
+	// modified Lentz's method
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < 1000; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return h * norm
+}
+
+// printFairness reports the chi-squared fairness test of every trial: its
+// mean statistic and p-value and how many trials reject block production
+// proportional to power at fairnessAlpha.
+func printFairness(cts []*ChainTracker) {
+	chiSqs := make([]float64, 0, len(cts))
+	pValues := make([]float64, 0, len(cts))
+	rejected := 0
+	for _, ct := range cts {
+		powers := make([]float64, len(ct.miners))
+		for _, m := range ct.miners {
+			powers[m.ID()] = m.Power()
+		}
+		chiSq, p := fairnessTest(ct, powers)
+		chiSqs = append(chiSqs, chiSq)
+		pValues = append(pValues, p)
+		if p < fairnessAlpha {
+			rejected++
+		}
+	}
+	meanChiSq, _ := meanAndVariance(chiSqs)
+	meanP, _ := meanAndVariance(pValues)
+	reportf("block production vs power: chi-squared %f, p-value %f; %d of %d trials reject production proportional to power at p<%g\n",
+		meanChiSq, meanP, rejected, len(cts), fairnessAlpha)
+}
@@ -0,0 +1,261 @@
+package sim
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+//**** Library entry point
+
+// Config configures the trials Run simulates.  Each field holds the
+// command line flag of the same name, see -h; DefaultConfig returns the
+// flags' defaults.
+type Config struct {
+	Miners      int
+	Rounds      int
+	LBP         int
+	LBPSchedule string
+	Trials      int
+	// base RNG seed, trial n is seeded with *Seed+n; nil for random seeds
+	Seed     *int64
+	Honest   float64
+	Powers   string
+	HashRate bool
+	// seed for the tickets of genesis and its ancestors; nil to draw them
+	// from each trial's seed
+	GenesisSeed *int64
+	Partition   string
+	Topology    string
+	LinkDelay   int
+	TicketSpace int64
+	Adversary   float64
+	BlockReward float64
+	TxPerBlock  int
+	BlockTime   time.Duration
+	TieBreak    string
+	ForkChoice  string
+
+	Disagreements bool
+	Weight        string
+	MaxTipsetSize int
+	Prune         int
+	Difficulty    string
+	Election      string
+	Script        string
+	Attack        string
+	ReorgDepth    int
+	MaxForks      int
+	Risk          float64
+	SlashPenalty  float64
+	Mix           string
+	Churn         string
+	// log level, see -v and SetLogWriter; DefaultConfig logs every block,
+	// as -v does by default for a single trial
+	Verbosity int
+	Strict    bool
+}
+
+// DefaultConfig returns the config the command line runs with when no flag
+// is passed
+func DefaultConfig() Config {
+	return defineSimFlags(flag.NewFlagSet("", flag.ContinueOnError)).toConfig()
+}
+
+// Run simulates cfg.Trials trials of cfg in parallel and returns their
+// chains in trial order.  It reports no progress; trials log through
+// SetLogWriter as they do on the command line.
+func Run(cfg Config) ([]*ChainTracker, error) {
+	sc, err := cfg.build()
+	if err != nil {
+		return nil, err
+	}
+	var seedFor func(n int) int64
+	if cfg.Seed != nil {
+		seed := *cfg.Seed
+		seedFor = func(n int) int64 { return seed + int64(n) }
+	}
+	return runTrials(sc, cfg.Trials, seedFor, true)
+}
+
+// build validates the config and builds the simulation config from it
+func (c Config) build() (*simConfig, error) {
+	lbp := c.LBP
+	totalMiners := c.Miners
+	honestFrac := c.Honest
+
+	if c.Trials <= 0 {
+		return nil, fmt.Errorf("invalid -trials %d: must be positive", c.Trials)
+	}
+
+	if lbp < 1 {
+		return nil, fmt.Errorf("invalid -lbp %d: must be at least 1", lbp)
+	}
+
+	if c.Prune < 0 {
+		return nil, fmt.Errorf("invalid -prune %d: must not be negative", c.Prune)
+	}
+
+	if c.MaxForks < 0 {
+		return nil, fmt.Errorf("invalid -maxForks %d: must not be negative", c.MaxForks)
+	}
+
+	if c.Risk < 0 || c.Risk > 1 {
+		return nil, fmt.Errorf("invalid -risk %g: must be between 0 and 1", c.Risk)
+	}
+
+	if honestFrac < 0 || honestFrac > 1 {
+		return nil, fmt.Errorf("invalid -honest %g: must be between 0 and 1", honestFrac)
+	}
+
+	if c.Adversary < 0 || c.Adversary > 1 {
+		return nil, fmt.Errorf("invalid -adversary %g: must be between 0 and 1", c.Adversary)
+	}
+
+	if c.TxPerBlock < 0 {
+		return nil, fmt.Errorf("invalid -txPerBlock %d: must not be negative", c.TxPerBlock)
+	}
+
+	if c.BlockTime < 0 {
+		return nil, fmt.Errorf("invalid -blockTime %s: must not be negative", c.BlockTime)
+	}
+
+	if c.TicketSpace <= 0 {
+		return nil, fmt.Errorf("invalid -ticketSpace %d: must be positive", c.TicketSpace)
+	}
+
+	powers, hashRates, err := minerPowers(totalMiners, c.Powers, c.HashRate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -powers: %s", err)
+	}
+
+	lbps := constantLBP(lbp)
+	if c.LBPSchedule != "" {
+		lbps, err = parseLBPSchedule(c.LBPSchedule, lbp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -lbpSchedule: %s", err)
+		}
+	}
+
+	election, err := parseElection(c.Election)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -election: %s", err)
+	}
+
+	var oracle ElectionOracle
+	if c.Script != "" {
+		script, err := parseScriptedElection(c.Script, totalMiners)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -script: %s", err)
+		}
+		oracle = script
+	}
+
+	difficulty, err := parseDifficulty(c.Difficulty)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -difficulty: %s", err)
+	}
+
+	if c.Attack != "" && c.Attack != "balance" && c.Attack != "reorg" {
+		return nil, fmt.Errorf("invalid -attack %q: must be balance or reorg", c.Attack)
+	}
+
+	if c.ReorgDepth < 1 {
+		return nil, fmt.Errorf("invalid -reorgDepth %d: must be at least 1", c.ReorgDepth)
+	}
+
+	var mix StrategyMix
+	if c.Mix != "" {
+		if mix, err = parseStrategyMix(c.Mix); err != nil {
+			return nil, fmt.Errorf("invalid -mix: %s", err)
+		}
+	}
+
+	var churn ChurnSchedule
+	if c.Churn != "" {
+		churn, err = parseChurn(c.Churn)
+		if err == nil {
+			err = churn.validate(totalMiners)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid -churn: %s", err)
+		}
+	}
+
+	if _, err := parseWeightFunc(c.Weight); err != nil {
+		return nil, fmt.Errorf("invalid -weight: %s", err)
+	}
+	if c.MaxTipsetSize < 0 {
+		return nil, fmt.Errorf("invalid -maxTipsetSize %d: must not be negative", c.MaxTipsetSize)
+	}
+
+	tieBreaker, err := parseTieBreaker(c.TieBreak)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -tiebreak: %s", err)
+	}
+
+	forkChoice, err := parseForkChoice(c.ForkChoice)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -forkchoice: %s", err)
+	}
+
+	var partitions *PartitionSchedule
+	if c.Partition != "" {
+		partitions, err = parsePartition(c.Partition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -partition: %s", err)
+		}
+	}
+
+	var topology topologyFactory
+	if c.Topology != "" {
+		topology, err = parseTopology(c.Topology, c.LinkDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -topology: %s", err)
+		}
+	}
+
+	cfg := &simConfig{
+		totalMiners: totalMiners,
+		rounds:      c.Rounds,
+		lbps:        lbps,
+		honestFrac:  honestFrac,
+		powers:      powers,
+		hashRates:   hashRates,
+		partitions:  partitions,
+		topology:    topology,
+		ticketSpace: uint64(c.TicketSpace),
+
+		adversaryFrac: c.Adversary,
+		blockReward:   c.BlockReward,
+		txPerBlock:    c.TxPerBlock,
+		election:      election,
+		oracle:        oracle,
+		blockTime:     c.BlockTime,
+		tieBreaker:    tieBreaker,
+		forkChoice:    forkChoice,
+		disagreements: c.Disagreements,
+		weight:        c.Weight,
+		maxTipsetSize: c.MaxTipsetSize,
+		prune:         c.Prune,
+		difficulty:    difficulty,
+		genesisSeed:   c.GenesisSeed,
+		attack:        c.Attack,
+		reorgDepth:    c.ReorgDepth,
+		maxForks:      c.MaxForks,
+		risk:          c.Risk,
+		slashPenalty:  c.SlashPenalty,
+		mix:           mix,
+		churn:         churn,
+		verbosity:     c.Verbosity,
+		strict:        c.Strict,
+	}
+	if err := cfg.checkRoles(); err != nil {
+		honest := fmt.Sprintf("-honest %g", honestFrac)
+		if mix != nil {
+			honest = "-mix"
+		}
+		return nil, fmt.Errorf("invalid %s and -adversary %g: %s", honest, c.Adversary, err)
+	}
+	return cfg, nil
+}
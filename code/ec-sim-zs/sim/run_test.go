@@ -0,0 +1,52 @@
+package sim_test
+
+import (
+	"strings"
+	"testing"
+
+	"consensus/sim"
+)
+
+func TestRun(t *testing.T) {
+	cfg := sim.DefaultConfig()
+	cfg.Miners, cfg.Rounds, cfg.LBP, cfg.Trials = 8, 40, 3, 3
+	seed := int64(7)
+	cfg.Seed = &seed
+
+	cts, err := sim.Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cts) != cfg.Trials {
+		t.Fatalf("%d chains, want %d", len(cts), cfg.Trials)
+	}
+	again, err := sim.Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, ct := range cts {
+		if ct.MaxHeight() != cfg.Rounds-1 {
+			t.Errorf("trial %d mined up to height %d, want %d", n, ct.MaxHeight(), cfg.Rounds-1)
+		}
+		if len(ct.Miners()) != cfg.Miners {
+			t.Errorf("trial %d has %d miners, want %d", n, len(ct.Miners()), cfg.Miners)
+		}
+		head := ct.Head()
+		for _, blk := range head.Blocks {
+			if ct.Block(blk.Nonce) != blk {
+				t.Errorf("trial %d has no block %d of its head", n, blk.Nonce)
+			}
+		}
+		if got := again[n].Head().Name; got != head.Name {
+			t.Errorf("trial %d ends on head %s, then %s with the same seed", n, head.Name, got)
+		}
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	cfg := sim.DefaultConfig()
+	cfg.LBP = 0
+	if _, err := sim.Run(cfg); err == nil || !strings.Contains(err.Error(), "-lbp") {
+		t.Errorf("Run with no lookback returned %v, want an -lbp error", err)
+	}
+}
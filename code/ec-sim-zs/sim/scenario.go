@@ -0,0 +1,308 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// buildScenario builds the chain described by spec without running the
+// simulation, so that the head, reorg and metric bookkeeping can be checked
+// against a hand-authored chain.  spec lists rounds separated by newlines or
+// ";", each "round N:" followed by the blocks delivered in it, separated by
+// ",":
+//
+//	round 0: genesis
+//	round 1: m0 wins on genesis, m1 null
+//	round 2: m0 on m0@1, x=m2 on m0@1
+//	round 3: m1 on m0@2+x ticket 7
+//
+// A block is mK, mined by miner K, optionally followed by "wins" (the
+// default) or "null", "on" its parents and "ticket" its ticket.  Parents are
+// "genesis", mK@H for miner K's block at height H, or a label given to a
+// block as label=mK, joined by "+" into a tipset; they default to the head
+// after the previous round.  Round 0 can only hold genesis and may be left
+// out, but the other rounds run from 1 without gaps, as a block delivered in
+// round N is at height N.  Tickets default to the block's nonce, so blocks
+// sort in the order they are listed.
+//
+// Miners 0 up to the highest one named share power equally.  Null blocks
+// are tracked as the simulation's are, but not delivered.
+func buildScenario(spec string) (*ChainTracker, error) {
+	rounds, totalMiners, err := parseScenario(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	miners := make([]Miner, totalMiners)
+	for id := range miners {
+		miners[id] = NewRationalMiner(id, 1/float64(totalMiners), totalMiners, bigOlNum, nil)
+	}
+	ct := NewChainTracker(miners)
+	ct.lbps = constantLBP(1)
+	ct.ticketSpace = bigOlNum
+
+	gen, err := makeGen(ct, 1, totalMiners, bigOlNum, seededSource(0))
+	if err != nil {
+		return nil, err
+	}
+	ct.head = ct.NewTipset([]*Block{gen})
+	ct.setHead(0, []*Block{gen})
+	ct.allBlocks[gen.Nonce] = gen
+	ct.liveBlocksByHeight[0] = []*Block{gen}
+
+	b := &scenarioBuilder{
+		ct:      ct,
+		labels:  map[string]*Block{"genesis": gen},
+		tipsets: map[string]*Tipset{ct.head.Name: ct.head},
+	}
+	for round, items := range rounds {
+		if round == 0 {
+			continue
+		}
+		if err := b.deliver(round, items); err != nil {
+			return nil, fmt.Errorf("round %d: %s", round, err)
+		}
+	}
+	ct.maxHeight = len(rounds) - 1
+
+	if err := verifyTrackerConsistency(ct); err != nil {
+		return nil, err
+	}
+	if err := verifyHeadConsistency(ct); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// scenarioBlock is a block of a scenario as written, before it is built
+type scenarioBlock struct {
+	label   string
+	miner   int
+	null    bool
+	parents []string
+	ticket  *uint64
+}
+
+// parseScenario parses a scenario spec into the blocks of each round, round
+// 0 first, and returns them along with the number of miners named.
+func parseScenario(spec string) ([][]scenarioBlock, int, error) {
+	rounds := [][]scenarioBlock{nil}
+	totalMiners := 1
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == '\n' || r == ';' }) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		fields := strings.Fields(parts[0])
+		if len(parts) != 2 || len(fields) != 2 || fields[0] != "round" {
+			return nil, 0, fmt.Errorf("%q must be of the form round N: blocks", line)
+		}
+		round, err := strconv.Atoi(fields[1])
+		if err != nil || round < 0 {
+			return nil, 0, fmt.Errorf("invalid round %q", fields[1])
+		}
+
+		if round == 0 {
+			if len(rounds) > 1 || strings.TrimSpace(parts[1]) != "genesis" {
+				return nil, 0, fmt.Errorf("round 0 must come first and only hold genesis")
+			}
+			continue
+		}
+		if round != len(rounds) {
+			return nil, 0, fmt.Errorf("round %d follows round %d", round, len(rounds)-1)
+		}
+
+		var blocks []scenarioBlock
+		for _, item := range strings.Split(parts[1], ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			sb, err := parseScenarioBlock(item)
+			if err != nil {
+				return nil, 0, fmt.Errorf("round %d: %s", round, err)
+			}
+			if sb.miner >= totalMiners {
+				totalMiners = sb.miner + 1
+			}
+			blocks = append(blocks, sb)
+		}
+		rounds = append(rounds, blocks)
+	}
+	return rounds, totalMiners, nil
+}
+
+// parseScenarioBlock parses a single block of a scenario round
+func parseScenarioBlock(item string) (scenarioBlock, error) {
+	var sb scenarioBlock
+	fields := strings.Fields(item)
+	miner := fields[0]
+	if i := strings.Index(miner, "="); i >= 0 {
+		sb.label, miner = miner[:i], miner[i+1:]
+		if sb.label == "" || sb.label == "genesis" || strings.ContainsAny(sb.label, "@+") {
+			return sb, fmt.Errorf("invalid label %q", sb.label)
+		}
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(miner, "m"))
+	if !strings.HasPrefix(miner, "m") || err != nil || id < 0 {
+		return sb, fmt.Errorf("invalid miner %q: must be mK", miner)
+	}
+	sb.miner = id
+
+	for i := 1; i < len(fields); i++ {
+		switch fields[i] {
+		case "wins":
+		case "null":
+			sb.null = true
+		case "on", "ticket":
+			if i+1 == len(fields) {
+				return sb, fmt.Errorf("%q needs a value in %q", fields[i], strings.TrimSpace(item))
+			}
+			if fields[i] == "on" {
+				sb.parents = strings.Split(fields[i+1], "+")
+			} else {
+				t, err := strconv.ParseUint(fields[i+1], 10, 64)
+				if err != nil {
+					return sb, fmt.Errorf("invalid ticket %q", fields[i+1])
+				}
+				sb.ticket = &t
+			}
+			i++
+		default:
+			return sb, fmt.Errorf("unexpected %q in %q", fields[i], strings.TrimSpace(item))
+		}
+	}
+	return sb, nil
+}
+
+// scenarioBuilder delivers the rounds of a scenario to its chain tracker
+type scenarioBuilder struct {
+	ct *ChainTracker
+	// blocks by label, genesis included
+	labels map[string]*Block
+	// tipsets by name, so that blocks with the same parents share them as
+	// they do in the simulation
+	tipsets map[string]*Tipset
+}
+
+// deliver builds the blocks of round and delivers its non-null ones, as
+// runRounds does with the blocks mined the round before.
+func (b *scenarioBuilder) deliver(round int, items []scenarioBlock) error {
+	ct := b.ct
+	var live []*Block
+	for _, sb := range items {
+		parents := ct.head
+		if sb.parents != nil {
+			var err error
+			if parents, err = b.tipset(sb.parents); err != nil {
+				return err
+			}
+		}
+		if parents.getHeight() != round-1 {
+			return fmt.Errorf("m%d mines on %s at height %d, not %d", sb.miner, parents.Name, parents.getHeight(), round-1)
+		}
+
+		liveParents := parents
+		if parents.Blocks[0].Null {
+			liveParents = parents.Blocks[0].liveParents()
+		}
+		blk := &Block{
+			Nonce:        ct.newNonce(),
+			Parents:      parents,
+			Owner:        sb.miner,
+			Height:       round,
+			Null:         sb.null,
+			ParentWeight: liveParents.Weight,
+			Timestamp:    parents.Blocks[0].Timestamp,
+		}
+		blk.Seed = uint64(blk.Nonce)
+		if sb.ticket != nil {
+			blk.Seed = *sb.ticket
+		}
+		if !sb.null {
+			blk.WinCount = 1
+			ct.wins[round]++
+		}
+		ct.attempts[round]++
+
+		if sb.label != "" {
+			if _, ok := b.labels[sb.label]; ok {
+				return fmt.Errorf("label %s used twice", sb.label)
+			}
+			b.labels[sb.label] = blk
+		}
+		if blk.Null {
+			ct.allBlocks[blk.Nonce] = blk
+		} else {
+			live = append(live, blk)
+		}
+	}
+
+	ct.blocksPerRound = append(ct.blocksPerRound, len(live))
+	if ct.wins[round] == 0 {
+		ct.stalls++
+	}
+	ct.setHead(round, live)
+	b.tipsets[ct.head.Name] = ct.head
+	for _, blk := range live {
+		ct.allBlocks[blk.Nonce] = blk
+	}
+	if len(live) > 0 {
+		ct.liveBlocksByHeight[round] = live
+	}
+	return nil
+}
+
+// tipset returns the tipset of the blocks refs name
+func (b *scenarioBuilder) tipset(refs []string) (*Tipset, error) {
+	blocks := make([]*Block, len(refs))
+	for i, ref := range refs {
+		blk, err := b.block(ref)
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = blk
+	}
+	ts, err := b.ct.checkedTipset(blocks)
+	if err != nil {
+		return nil, err
+	}
+	if shared, ok := b.tipsets[ts.Name]; ok {
+		return shared, nil
+	}
+	b.tipsets[ts.Name] = ts
+	return ts, nil
+}
+
+// block returns the block ref names: a label, or mK@H for the only block
+// miner K has at height H
+func (b *scenarioBuilder) block(ref string) (*Block, error) {
+	if blk, ok := b.labels[ref]; ok {
+		return blk, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(ref, "m"), "@")
+	if !strings.HasPrefix(ref, "m") || len(parts) != 2 {
+		return nil, fmt.Errorf("unknown block %q", ref)
+	}
+	miner, err1 := strconv.Atoi(parts[0])
+	height, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("unknown block %q", ref)
+	}
+
+	var found *Block
+	for _, blk := range b.ct.allBlocks {
+		if blk.Owner != miner || blk.Height != height {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("miner %d has several blocks at height %d, label them", miner, height)
+		}
+		found = blk
+	}
+	if found == nil {
+		return nil, fmt.Errorf("miner %d has no block at height %d", miner, height)
+	}
+	return found, nil
+}
@@ -0,0 +1,95 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+)
+
+// reorgScenario has miner 0 lead for two rounds before miners 1 and 2 build
+// a heavier chain on miner 1's null block, rolling back miner 0's blocks
+const reorgScenario = `round 0: genesis
+round 1: m0, m1 null on genesis
+round 2: m0, m2 on m1@1
+round 3: m1 on m2@2, m2 on m2@2`
+
+func TestBuildScenario(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec string
+		// height and number of blocks of the head, depths of the reorgs and
+		// orphans left
+		height, headBlocks int
+		reorgs             []int
+		orphans            int
+	}{
+		// the head moves to the heavier chain with a single reorg of depth
+		// 2, leaving miner 0's two blocks orphaned
+		{"reorg", reorgScenario, 3, 2, []int{2}, 2},
+		{"head by default", "round 1: m0, m1; round 2: m1", 2, 1, nil, 0},
+		{"labels and tickets", "round 1: a=m0 ticket 9, b=m1 ticket 3; round 2: m2 on a+b", 2, 1, nil, 0},
+		{"on a null block", "round 1: m0 null, m1 null; round 2: m0 on m0@1, m1 on m1@1", 2, 1, nil, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ct, err := buildScenario(tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct.head.getHeight() != tc.height || len(ct.head.Blocks) != tc.headBlocks {
+				t.Errorf("head is %s at height %d, want %d blocks at height %d", ct.head.Name, ct.head.getHeight(), tc.headBlocks, tc.height)
+			}
+			var depths []int
+			for _, ev := range ct.reorgEvents {
+				depths = append(depths, ev.Depth)
+			}
+			if len(depths) != len(tc.reorgs) {
+				t.Errorf("reorg depths %v, want %v", depths, tc.reorgs)
+			} else {
+				for i := range depths {
+					if depths[i] != tc.reorgs[i] {
+						t.Errorf("reorg depths %v, want %v", depths, tc.reorgs)
+						break
+					}
+				}
+			}
+			if n := orphanCount(ct, 0); n != tc.orphans {
+				t.Errorf("%d orphans, want %d", n, tc.orphans)
+			}
+		})
+	}
+}
+
+func TestBuildScenarioErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec string
+		// substring of the error
+		want string
+	}{
+		{"no round", "m0, m1", "must be of the form round N: blocks"},
+		{"bad round", "round x: m0", `invalid round "x"`},
+		{"negative round", "round -1: m0", `invalid round "-1"`},
+		{"round 0 late", "round 1: m0; round 0: genesis", "round 0 must come first"},
+		{"round 0 blocks", "round 0: m0", "round 0 must come first"},
+		{"gap", "round 1: m0; round 3: m0", "round 3 follows round 1"},
+		{"bad miner", "round 1: x0", `invalid miner "x0"`},
+		{"negative miner", "round 1: m-1", `invalid miner "m-1"`},
+		{"bad label", "round 1: genesis=m0", `invalid label "genesis"`},
+		{"label twice", "round 1: a=m0, a=m1", "label a used twice"},
+		{"on without parents", "round 1: m0 on", `"on" needs a value`},
+		{"bad ticket", "round 1: m0 ticket x", `invalid ticket "x"`},
+		{"unexpected word", "round 1: m0 loses", `unexpected "loses"`},
+		{"unknown block", "round 1: m0 on nowhere", `unknown block "nowhere"`},
+		{"unknown miner", "round 1: m0; round 2: m1 on m5@1", "miner 5 has no block at height 1"},
+		{"no block at height", "round 1: m0; round 2: m0; round 3: m1 on m0@1", "mines on"},
+		{"bad height", "round 1: m0; round 2: m1 on m0@x", `unknown block "m0@x"`},
+		{"ambiguous block", "round 1: m0 ticket 1, m0 ticket 2; round 2: m1 on m0@1", "miner 0 has several blocks at height 1"},
+		{"stale parents", "round 1: m0; round 2: m0; round 3: m1 on genesis", "at height 0, not 2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := buildScenario(tc.spec)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("buildScenario(%q) returned %v, want an error with %q", tc.spec, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//**** Lookback schedule
+
+// lbpChange sets the lookback parameter from a height onwards
+type lbpChange struct {
+	Height int `json:"height"`
+	LBP    int `json:"lbp"`
+}
+
+// lbpSchedule lists lookback changes sorted by height, starting at height 0
+type lbpSchedule []lbpChange
+
+// parseLBPSchedule parses a spec of the form "1@0,30@100,100@200" giving the
+// lookback to use from each height onwards.  Heights before the first change
+// use base.
+func parseLBPSchedule(spec string, base int) (lbpSchedule, error) {
+	var sched lbpSchedule
+	for _, entry := range strings.Split(spec, ",") {
+		kv := strings.Split(entry, "@")
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("schedule entry %q must be of the form lbp@height", entry)
+		}
+		lbp, err := strconv.Atoi(kv[0])
+		if err != nil || lbp <= 0 {
+			return nil, fmt.Errorf("invalid lbp %q", kv[0])
+		}
+		height, err := strconv.Atoi(kv[1])
+		if err != nil || height < 0 {
+			return nil, fmt.Errorf("invalid height %q", kv[1])
+		}
+		sched = append(sched, lbpChange{Height: height, LBP: lbp})
+	}
+
+	sort.SliceStable(sched, func(i, j int) bool { return sched[i].Height < sched[j].Height })
+	for i := 1; i < len(sched); i++ {
+		if sched[i].Height == sched[i-1].Height {
+			return nil, fmt.Errorf("lbp set twice at height %d", sched[i].Height)
+		}
+	}
+	if sched[0].Height > 0 {
+		sched = append(lbpSchedule{{Height: 0, LBP: base}}, sched...)
+	}
+	return sched, nil
+}
+
+// constantLBP returns a schedule using lbp at every height
+func constantLBP(lbp int) lbpSchedule {
+	return lbpSchedule{{Height: 0, LBP: lbp}}
+}
+
+// validate checks a schedule read from elsewhere, such as a saved chain:
+// it must start at height 0 with heights increasing and lookbacks positive
+func (s lbpSchedule) validate() error {
+	if len(s) == 0 || s[0].Height != 0 {
+		return fmt.Errorf("lbp schedule must start at height 0")
+	}
+	for i, c := range s {
+		if c.LBP <= 0 {
+			return fmt.Errorf("invalid lbp %d at height %d", c.LBP, c.Height)
+		}
+		if i > 0 && c.Height <= s[i-1].Height {
+			return fmt.Errorf("lbp schedule heights must increase, %d follows %d", c.Height, s[i-1].Height)
+		}
+	}
+	return nil
+}
+
+// at returns the lookback in effect for blocks mined atop parents at height,
+// i.e. for blocks at height+1
+func (s lbpSchedule) at(height int) int {
+	i := sort.Search(len(s), func(i int) bool { return s[i].Height > height })
+	return s[i-1].LBP
+}
+
+// String returns the schedule as parsed by parseLBPSchedule, or just the
+// lookback if it never changes
+func (s lbpSchedule) String() string {
+	if len(s) == 1 {
+		return strconv.Itoa(s[0].LBP)
+	}
+	entries := make([]string, len(s))
+	for i, c := range s {
+		entries[i] = fmt.Sprintf("%d@%d", c.LBP, c.Height)
+	}
+	return strings.Join(entries, ",")
+}
+
+// max returns the largest lookback used anywhere in the schedule
+func (s lbpSchedule) max() int {
+	max := 0
+	for _, c := range s {
+		if c.LBP > max {
+			max = c.LBP
+		}
+	}
+	return max
+}
@@ -0,0 +1,65 @@
+package sim
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLBPScheduleAt(t *testing.T) {
+	sched, err := parseLBPSchedule("30@100,100@200", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		parentHeight int
+		want         int
+	}{
+		{0, 1},
+		// blocks at height 100 are mined atop parents at height 99
+		{99, 1},
+		{100, 30},
+		{199, 30},
+		{200, 100},
+		{5000, 100},
+	} {
+		if got := sched.at(tc.parentHeight); got != tc.want {
+			t.Errorf("at(%d) = %d, want %d", tc.parentHeight, got, tc.want)
+		}
+	}
+	if got, want := sched.String(), "1@0,30@100,100@200"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := constantLBP(5).String(), "5"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestLBPScheduleSavedWithChain(t *testing.T) {
+	cfg := testConfig(t, 6, 30, 1)
+	var err error
+	if cfg.lbps, err = parseLBPSchedule("3@10,5@20", 1); err != nil {
+		t.Fatal(err)
+	}
+	ct, err := runSim(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeChain(ct, "chain", dir)
+	loaded, err := loadChain(filepath.Join(dir, "chain.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.lbps.String() != cfg.lbps.String() {
+		t.Fatalf("loaded schedule %s, want %s", loaded.lbps, cfg.lbps)
+	}
+
+	// resuming goes on with the saved schedule whatever the config says
+	cfg.lbps = constantLBP(1)
+	if err := resumeSim(*cfg, loaded, 10, 2); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.lbps.String() != "1@0,3@10,5@20" {
+		t.Errorf("resumed with schedule %s", loaded.lbps)
+	}
+}
@@ -0,0 +1,106 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseShardSplit parses the -shardSplit flag: the comma separated fraction
+// of every miner's power given to each of the shards, summing to 1.  An
+// empty split divides power equally.
+func parseShardSplit(s string, shards int) ([]float64, error) {
+	if shards < 1 {
+		return nil, fmt.Errorf("need at least one shard, got %d", shards)
+	}
+	split := make([]float64, shards)
+	if s == "" {
+		for k := range split {
+			split[k] = 1 / float64(shards)
+		}
+		return split, nil
+	}
+
+	fields := strings.Split(s, ",")
+	if len(fields) != shards {
+		return nil, fmt.Errorf("%d fractions given for %d shards", len(fields), shards)
+	}
+	var total float64
+	for k, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid fraction %q", f)
+		}
+		split[k] = v
+		total += v
+	}
+	if total < 1-1e-9 || total > 1+1e-9 {
+		return nil, fmt.Errorf("fractions sum to %f, not 1", total)
+	}
+	return split, nil
+}
+
+// shardConfig returns the config of shard k: every miner mines it with
+// split[k] of its power, and its trials and genesis are seeded apart from
+// the other shards'.
+func shardConfig(cfg simConfig, split []float64, k int, seedFor func(n int) int64) (simConfig, func(n int) int64) {
+	powers := make([]float64, len(cfg.powers))
+	for i, p := range cfg.powers {
+		powers[i] = p * split[k]
+	}
+	cfg.powers = powers
+	if cfg.hashRates != nil {
+		rates := make([]float64, len(cfg.hashRates))
+		for i, r := range cfg.hashRates {
+			rates[i] = r * split[k]
+		}
+		cfg.hashRates = rates
+	}
+	if cfg.genesisSeed != nil {
+		seed := minerRand(*cfg.genesisSeed, k).Int63()
+		cfg.genesisSeed = &seed
+	}
+	if seedFor == nil {
+		return cfg, nil
+	}
+	return cfg, func(n int) int64 { return minerRand(seedFor(n), k).Int63() }
+}
+
+// runShards runs trials of len(split) independent chains, each mined by
+// every miner with its share of power from split, alongside the unsharded
+// chain mined with full power.  Since a miner's split doesn't change from
+// round to round the shards share no state and are simulated one after the
+// other.  It reports each shard's fork and orphan rates against the
+// unsharded chain's, leaving out the first warmup heights.
+func runShards(cfg *simConfig, split []float64, trials int, seedFor func(n int) int64, quiet bool, warmup int) error {
+	reportln("=== unsharded")
+	base, err := runTrials(cfg, trials, seedFor, quiet)
+	if err != nil {
+		return fmt.Errorf("unsharded: %s", err)
+	}
+
+	shards := make([][]*ChainTracker, len(split))
+	for k := range split {
+		reportf("=== shard %d\n", k)
+		scfg, sseedFor := shardConfig(*cfg, split, k, seedFor)
+		if shards[k], err = runTrials(&scfg, trials, sseedFor, quiet); err != nil {
+			return fmt.Errorf("shard %d: %s", k, err)
+		}
+	}
+
+	report := func(label string, cts []*ChainTracker) {
+		forks := make([]float64, len(cts))
+		orphans := make([]float64, len(cts))
+		for i, ct := range cts {
+			forks[i] = averageLiveForksPerRound(ct, warmup)
+			orphans[i] = orphanRate(ct, warmup)
+		}
+		printSummary(label+": average live forks per round", forks)
+		printSummary(label+": average orphan rate", orphans)
+	}
+	report("unsharded", base)
+	for k, cts := range shards {
+		report(fmt.Sprintf("shard %d (%g of power)", k, split[k]), cts)
+	}
+	return nil
+}
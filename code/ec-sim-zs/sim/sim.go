@@ -0,0 +1,1624 @@
+// Package sim simulates Expected Consensus: miners electing leaders from
+// tickets, building tipsets and choosing among forks, round after round.
+// Run simulates trials of a Config and returns each trial's ChainTracker;
+// Main runs the ec-sim-zs command line.
+package sim
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default size of the ticket space, see -ticketSpace
+const bigOlNum = 100000
+
+//**** Utils
+
+// Verbosity levels of logf
+const (
+	// round summaries and head changes
+	logRounds = 1
+	// per-miner fork counts
+	logMiners = 2
+	// every block
+	logBlocks = 3
+)
+
+// logf logs the formatted output if the chain's verbosity is at least
+// level, see SetLogWriter
+func (ct *ChainTracker) logf(level int, format string, args ...interface{}) {
+	if ct.verbosity >= level {
+		logger.printf(level, format, args...)
+	}
+}
+
+// minerRand returns the RNG of a miner in a trial seeded with seed.  Each
+// miner's RNG is seeded from a hash of the trial seed and its ID, so streams
+// of different miners are independent and no RNG is shared across miners.
+func minerRand(seed int64, minerID int) *rand.Rand {
+	var msg [16]byte
+	binary.BigEndian.PutUint64(msg[:8], uint64(seed))
+	binary.BigEndian.PutUint64(msg[8:], uint64(minerID))
+	sum := sha256.Sum256(msg[:])
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+}
+
+// randSource draws the random numbers of a run that no miner draws: the
+// seeds of unseeded trials and the tickets of genesis.  A seeded source
+// replays the same numbers; the zero source reads crypto/rand, for runs
+// nothing was seeded for.
+type randSource struct {
+	rng *rand.Rand
+}
+
+// seededSource returns a source replaying the RNG seeded with seed
+func seededSource(seed int64) randSource {
+	return randSource{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Int63n returns a random number in [0, n), or an error if crypto/rand
+// can't be read
+func (s randSource) Int63n(n int64) (int64, error) {
+	if s.rng != nil {
+		return s.rng.Int63n(n), nil
+	}
+	v, err := crand.Int(crand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, fmt.Errorf("drawing a random number: %s", err)
+	}
+	return v.Int64(), nil
+}
+
+// newSeed returns a seed for a trial that wasn't given one
+func newSeed() (int64, error) {
+	return randSource{}.Int63n(1 << 62)
+}
+
+//**** Helpers
+
+// makeGen makes the genesis block.  In the case the lbp is more than 1 it also
+// makes lbp -1 genesis ancestors for sampling the first lbp - 1 blocks after genesis.
+// Their tickets are drawn from src and their nonces from ct.
+func makeGen(ct *ChainTracker, lbp int, totalMiners int, ticketSpace uint64, src randSource) (*Block, error) {
+	var gen *Tipset
+	for i := 0; i < lbp; i++ {
+		seed, err := src.Int63n(int64(ticketSpace) * int64(totalMiners))
+		if err != nil {
+			return nil, err
+		}
+		gen = ct.NewTipset([]*Block{&Block{
+			InHead:       true,
+			Nonce:        ct.newNonce(),
+			Parents:      gen,
+			Owner:        -1,
+			Height:       0,
+			Null:         false,
+			ParentWeight: 0,
+			Seed:         uint64(seed),
+		}})
+	}
+
+	// lookbacks from the first lbp heights reach back into the ancestors
+	length := 0
+	for ts := gen; ts != nil; ts = ts.getParents() {
+		length++
+	}
+	if length != lbp {
+		panic(fmt.Sprintf("Check your assumptions: genesis chain has %d tipsets for lbp %d", length, lbp))
+	}
+	return gen.Blocks[0], nil
+}
+
+// tipsetKey identifies the blocks that can be grouped into a tipset
+type tipsetKey struct {
+	parents string
+	height  int
+}
+
+// Input a set of newly mined blocks, return the tipsets grouping these blocks
+// that obey the tipset invariants: one per set of parents and height, in the
+// order the groups first appear in blks.  Null blocks each get a tipset of
+// their own.  A block given more than once is only grouped once, so every
+// tipset is distinct.  Groups larger than the chain's maxTipsetSize keep
+// their lowest tickets, orphaning the rest.  Smaller tipsets within a group
+// are left to forksFromTipset.
+func (ct *ChainTracker) allTipsets(blks []*Block) []*Tipset {
+	var groups [][]*Block
+	index := make(map[tipsetKey]int)
+	seen := make(map[int]bool, len(blks))
+	for _, blk := range blks {
+		if seen[blk.Nonce] {
+			continue
+		}
+		seen[blk.Nonce] = true
+		if blk.Null {
+			groups = append(groups, []*Block{blk})
+			continue
+		}
+		key := tipsetKey{parents: parentName(blk), height: blk.Height}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], blk)
+	}
+
+	tipsets := make([]*Tipset, len(groups))
+	for i, group := range groups {
+		tipsets[i] = ct.NewTipset(ct.capTipset(group))
+	}
+	return tipsets
+}
+
+// capTipset sorts blocks by ticket and returns the chain's maxTipsetSize of
+// them with the lowest tickets, or all of them if tipsets aren't capped.
+// Blocks with the same ticket are kept oldest first, so the same blocks are
+// kept in whatever order they come.
+func (ct *ChainTracker) capTipset(blocks []*Block) []*Block {
+	if ct.maxTipsetSize == 0 || len(blocks) <= ct.maxTipsetSize {
+		sortBlocks(blocks)
+		return blocks
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].Seed != blocks[j].Seed {
+			return blocks[i].Seed < blocks[j].Seed
+		}
+		return blocks[i].Nonce < blocks[j].Nonce
+	})
+	return blocks[:ct.maxTipsetSize]
+}
+
+// forksFromTipset returns the n subsets of a tipset of length n: for every ticket
+// it returns a tipset containing the block containing that ticket and all blocks
+// containing a ticket larger than it.  This is a rational miner trying to mine
+// all possible non-slashable forks off of a tipset.
+func (ct *ChainTracker) forksFromTipset(ts *Tipset) []*Tipset {
+	var forks []*Tipset
+	// works because blocks are kept ordered in Tipsets
+	for i := range ts.Blocks {
+		currentFork := []*Block{ts.Blocks[i]}
+		for j := i + 1; j < len(ts.Blocks); j++ {
+			currentFork = append(currentFork, ts.Blocks[j])
+		}
+		forks = append(forks, ct.NewTipset(currentFork))
+	}
+	return forks
+}
+
+func sortBlocks(blocks []*Block) {
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Seed < blocks[j].Seed })
+}
+
+func stringifyBlocks(blocks []*Block) string {
+	// blocks are already sorted... just do the easy thing
+	b := new(strings.Builder)
+	for i, blk := range blocks {
+		b.WriteString(strconv.Itoa(blk.Nonce))
+		if i != len(blocks)-1 {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+//**** Structs
+
+// Block
+type Block struct {
+	// Nonce is unique for each block
+	Nonce        int     `json:"nonce"`
+	Parents      *Tipset `json:"tipset"`
+	Owner        int     `json:"owner"`
+	Height       int     `json:"height"`
+	Null         bool    `json:"null"`
+	ParentWeight int     `json:"parentWeight"`
+	Seed         uint64  `json:"seed"`
+	InHead       bool    `json:"inHead"`
+	// number of times the block's election proof won, see electionWins
+	WinCount int `json:"winCount,omitempty"`
+	// the owner's VRF output over the lookback ticket, which the election
+	// is run on; only blocks that won carry it
+	ElectionProof uint64 `json:"electionProof,omitempty"`
+	// time since genesis at which the block was mined
+	Timestamp time.Duration `json:"timestamp"`
+}
+
+// Tipset
+// bringing in from json would need to manually link blocks into Tipset using name
+type Tipset struct {
+	// Blocks are sorted
+	Blocks    []*Block `json:"-"`
+	Name      string   `json:"name"`
+	MinTicket uint64   `json:"minTicket"`
+	WasHead   bool     `json:"wasHead"`
+	Weight    int      `json:"weight"`
+}
+
+// Chain tracker
+type ChainTracker struct {
+	// index tipsets per height
+	liveBlocksByHeight map[int][]*Block
+	allBlocks          map[int]*Block
+	maxHeight          int
+	head               *Tipset
+	miners             []Miner
+	// lookback parameter the chain was mined with at each height
+	lbps lbpSchedule
+	// size of the ticket space the chain was mined with
+	ticketSpace uint64
+	// number of non-null blocks mined in each round
+	blocksPerRound []int
+	// rounds in which every active miner's election came out null, whether
+	// or not blocks were delivered in them
+	stalls int
+	// reward paid for each block in the canonical chain
+	blockReward float64
+	// transactions carried by each block, see throughput
+	txPerBlock int
+	// duration of a round
+	blockTime time.Duration
+	// weight function NewTipset weighs tipsets with, see -weight, and the
+	// name it was selected by
+	weight     WeightFunc
+	weightName string
+	// cap on the blocks of a tipset, 0 for no cap, see -maxTipsetSize
+	maxTipsetSize int
+	// fork choice rule between tipsets of equal weight, min ticket if nil
+	tieBreaker TieBreaker
+	// network the miners were on, if any; not saved with the chain
+	topology *Topology
+	// rule picking the network's head
+	forkChoice forkChoiceRule
+	// whether to count the rounds in which GHOST and heaviest tipset would
+	// pick different heads, and the count; see keepsGhostTree
+	countDisagreements      bool
+	forkChoiceDisagreements int
+	// tree of live blocks for GHOST, built on the first setHead that needs
+	// it
+	ghost *ghostTree
+	// height of the oldest block kept by prune, 0 (genesis) if never pruned
+	prunedBelow int
+	// most heap in use just before pruning, and left by the prune that
+	// followed, in bytes; see pruneSampled
+	peakHeap, prunedHeap uint64
+	// lookback ancestors already found for tipsets at lookbackHeight, see
+	// lookback
+	lookbacks      map[lookbackKey]*Tipset
+	lookbackHeight int
+	// blocks mined in the last round, not yet delivered
+	pending []*Block
+	// winning blocks a miner publishes in the current round besides the one
+	// it mines, equivocating; see RationalMiner.Risk
+	equivocations []*Block
+	// penalty paid by a miner for each slashable equivocation
+	slashPenalty float64
+	// number of blocks generated at each height, null or not, i.e. mining
+	// attempts
+	attempts map[int]int
+	// number of blocks generated at each height that won their election,
+	// published or not
+	wins map[int]int
+	// head changes that rolled back blocks
+	reorgEvents []ReorgEvent
+	// attempts of reorg attackers to rewrite the chain, and the private
+	// chain they mine
+	reorgAttacks []ReorgAttack
+	reorgPool    *reorgPool
+	// miners joining the network, see rejoin
+	bootstraps []BootstrapEvent
+	// head at the start of each round
+	headTimeline []HeadSnapshot
+	// each miner's number of private forks at the end of each round, see
+	// privateForkSeries
+	forkCounts map[int]*forkCount
+	// number of distinct heads in the miners' views at the end of each
+	// round, see headAgreement
+	distinctHeads []int
+	// scale applied to every miner's power when checking election proofs,
+	// see adjustDifficulty, and its value in each round
+	difficulty   float64
+	difficulties []float64
+	// each miner's view of the head, which may differ from the network's
+	// when blocks aren't delivered to everyone (e.g. under a partition)
+	views map[int]*Tipset
+	// nonce of the next block made, see newNonce
+	nextNonce int
+	// level of the run's log, see logf
+	verbosity int
+	// whether to validate every tipset as it is built, see -strict, and the
+	// first one found broken, which ends the run
+	strict    bool
+	strictErr error
+}
+
+// newNonce returns a nonce no other block of the chain has.  Every trial
+// numbers its blocks from 0 on its own tracker, so trials run in parallel
+// share no counter and get the same nonces whatever the schedule.
+func (ct *ChainTracker) newNonce() int {
+	ct.nextNonce++
+	return ct.nextNonce - 1
+}
+
+// ReorgEvent records a head change in a round that rolled back Depth
+// non-null blocks of the old head's ancestry
+type ReorgEvent struct {
+	Round int
+	Depth int
+}
+
+// HeadSnapshot records the head chosen at the start of a round
+type HeadSnapshot struct {
+	Round  int    `json:"round"`
+	Head   string `json:"head"`
+	Weight int    `json:"weight"`
+}
+
+// Rational Miner
+type RationalMiner struct {
+	// fraction of network power, which elections are won with
+	MinerPower float64 `json:"power"`
+	// absolute hash rate the miner was configured with, for reporting, or
+	// 0 if powers were given as fractions
+	HashRate     float64            `json:"hashRate,omitempty"`
+	PrivateForks map[string]*Tipset `json:"privateForks"`
+	MinerID      int                `json:"id"`
+	TotalMiners  int                `json:"-"`
+	TicketSpace  uint64             `json:"-"`
+	Rand         *rand.Rand         `json:"-"`
+	Adversary    bool               `json:"adversary"`
+	Election     electionRule       `json:"-"`
+	// if set, overrides the outcome of the miner's elections
+	Oracle    ElectionOracle `json:"-"`
+	BlockTime time.Duration  `json:"-"`
+	// MaxForks limits the private forks mined on each round to the heaviest
+	// ones, dropping the rest (0 mines on all of them)
+	MaxForks int `json:"-"`
+	// Risk is the probability that, having won on several forks, the miner
+	// publishes all of its winning blocks rather than only the heaviest,
+	// equivocating
+	Risk float64 `json:"-"`
+}
+
+//**** Block helpers
+
+// parentLink is an edge of a drawn chain, from a block to a live parent
+type parentLink struct {
+	child, parent *Block
+}
+
+// parentLinks returns the edges from blocks to their live parents that chain
+// drawings link.  Genesis, or the oldest block kept if pruned, has none.
+func (ct *ChainTracker) parentLinks(blocks []*Block) []parentLink {
+	var links []parentLink
+	for _, block := range blocks {
+		if block.Height <= ct.prunedBelow {
+			continue
+		}
+		for _, parent := range block.liveParents().Blocks {
+			links = append(links, parentLink{block, parent})
+		}
+	}
+	return links
+}
+
+// Walk back until we find a tipset with a live parent
+func (bl *Block) liveParents() *Tipset {
+	// Tipsets with null blocks only contain one block (since null blocks are mined privately)
+	// All blocks in a tipset share parents
+	parents := bl.Parents
+	for parents.Blocks[0].Null {
+		parents = parents.Blocks[0].Parents
+	}
+	return parents
+}
+
+// weight returns the number of live blocks a non-null block counts as in its
+// tipset: its win count, or 1 for blocks that don't record one (e.g.
+// genesis).
+func (bl *Block) weight() int {
+	if bl.WinCount > 0 {
+		return bl.WinCount
+	}
+	return 1
+}
+
+//**** Tipset helpers
+
+// NewTipset groups blocks the simulation mined into a tipset weighed by the
+// chain's weight function.  Grouping no blocks is a bug; under -strict,
+// blocks breaking the tipset invariants are recorded in strictErr, which
+// runRounds fails on.  Blocks from elsewhere go through checkedTipset
+// instead.
+func (ct *ChainTracker) NewTipset(blocks []*Block) *Tipset {
+
+	if len(blocks) == 0 {
+		panic("Don't call weight on no parents")
+	}
+
+	sortBlocks(blocks)
+	if ct.strict && ct.strictErr == nil {
+		ts := &Tipset{Blocks: blocks, Name: stringifyBlocks(blocks)}
+		ct.strictErr = ts.Validate(ct.maxTipsetSize)
+	}
+	minTicket := blocks[0].Seed
+	for _, block := range blocks {
+		if block.Seed < minTicket {
+			minTicket = block.Seed
+		}
+	}
+
+	// Setting weight works because all blocks in a tipset have the same parent (see allTipsets)
+	// block weight is equal to parent tipset weight, so we simply apply the weight function
+	// to the number of non-null blocks here.
+	tsWeight := blocks[0].ParentWeight
+	if !blocks[0].Null {
+		live := 0
+		for _, block := range blocks {
+			live += block.weight()
+		}
+		tsWeight = ct.weight(tsWeight, live)
+	}
+
+	return &Tipset{
+		Blocks:    blocks,
+		Name:      stringifyBlocks(blocks),
+		MinTicket: minTicket,
+		WasHead:   false,
+		Weight:    tsWeight,
+	}
+}
+
+// checkedTipset groups blocks that didn't come from the simulation, such as
+// those of a loaded chain, into a tipset, returning an error rather than
+// panicking if there are none or they break the tipset invariants.
+func (ct *ChainTracker) checkedTipset(blocks []*Block) (*Tipset, error) {
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("tipset has no blocks")
+	}
+	sortBlocks(blocks)
+	ts := &Tipset{Blocks: blocks, Name: stringifyBlocks(blocks)}
+	if err := ts.Validate(ct.maxTipsetSize); err != nil {
+		return nil, err
+	}
+	return ct.NewTipset(blocks), nil
+}
+
+// Validate checks the invariants the simulation relies on: all blocks in a
+// tipset share parents and height, null blocks only ever form singleton
+// tipsets, no block appears twice, blocks are sorted by ticket and there are
+// no more than maxTipsetSize of them, if that is positive.
+func (ts *Tipset) Validate(maxTipsetSize int) error {
+	if len(ts.Blocks) == 0 {
+		return fmt.Errorf("tipset %s is empty", ts.Name)
+	}
+	if maxTipsetSize > 0 && len(ts.Blocks) > maxTipsetSize {
+		return fmt.Errorf("tipset %s has %d blocks, more than the maximum of %d", ts.Name, len(ts.Blocks), maxTipsetSize)
+	}
+	first := ts.Blocks[0]
+	for i, blk := range ts.Blocks {
+		if blk.Null && len(ts.Blocks) != 1 {
+			return fmt.Errorf("tipset %s has null block %d among %d blocks", ts.Name, blk.Nonce, len(ts.Blocks))
+		}
+		if blk.Height != first.Height {
+			return fmt.Errorf("tipset %s mixes heights %d and %d", ts.Name, first.Height, blk.Height)
+		}
+		if parentName(blk) != parentName(first) {
+			return fmt.Errorf("tipset %s mixes parents %s and %s", ts.Name, parentName(first), parentName(blk))
+		}
+		if i > 0 && blk.Seed < ts.Blocks[i-1].Seed {
+			return fmt.Errorf("tipset %s is not sorted by ticket", ts.Name)
+		}
+		for _, other := range ts.Blocks[:i] {
+			if other.Nonce == blk.Nonce {
+				return fmt.Errorf("tipset %s repeats block %d", ts.Name, blk.Nonce)
+			}
+		}
+	}
+	return nil
+}
+
+// parentName returns the name of a block's parent tipset, or "" for the
+// first genesis ancestor.
+func parentName(blk *Block) string {
+	if blk.Parents == nil {
+		return ""
+	}
+	return blk.Parents.Name
+}
+
+func (ts *Tipset) getHeight() int {
+	if len(ts.Blocks) == 0 {
+		panic("Don't call height on no parents")
+	}
+	// Works because all blocks in a tipset have same height (see allTipsets)
+	return ts.Blocks[0].Height
+}
+
+func (ts *Tipset) getParents() *Tipset {
+	if len(ts.Blocks) == 0 {
+		panic("Don't call parents on nil blocks")
+	}
+	return ts.Blocks[0].Parents
+}
+
+//**** CT Helpers
+
+func NewChainTracker(miners []Miner) *ChainTracker {
+	return &ChainTracker{
+		liveBlocksByHeight: make(map[int][]*Block),
+		allBlocks:          make(map[int]*Block),
+		maxHeight:          -1,
+		miners:             miners,
+		views:              make(map[int]*Tipset),
+		lookbacks:          make(map[lookbackKey]*Tipset),
+		attempts:           make(map[int]int),
+		wins:               make(map[int]int),
+		forkCounts:         make(map[int]*forkCount),
+		difficulty:         1,
+		weight:             additiveWeight,
+		weightName:         "additive",
+	}
+}
+
+// Head returns the network's head at the end of the run
+func (ct *ChainTracker) Head() *Tipset {
+	return ct.head
+}
+
+// MaxHeight returns the height of the last round mined
+func (ct *ChainTracker) MaxHeight() int {
+	return ct.maxHeight
+}
+
+// Miners returns the miners of the run, indexed by ID
+func (ct *ChainTracker) Miners() []Miner {
+	return ct.miners
+}
+
+// Block returns the block with the given nonce, or nil if there is none or
+// it was pruned
+func (ct *ChainTracker) Block(nonce int) *Block {
+	return ct.allBlocks[nonce]
+}
+
+// LiveBlocks returns the non-null blocks delivered at a height
+func (ct *ChainTracker) LiveBlocks(height int) []*Block {
+	return ct.liveBlocksByHeight[height]
+}
+
+// PrunedBelow returns the height of the oldest block kept by pruning, 0 if
+// the chain was never pruned
+func (ct *ChainTracker) PrunedBelow() int {
+	return ct.prunedBelow
+}
+
+// Stalls returns the number of rounds in which every active miner's
+// election came out null
+func (ct *ChainTracker) Stalls() int {
+	return ct.stalls
+}
+
+// ReorgEvents returns the head changes that rolled back blocks, in round
+// order
+func (ct *ChainTracker) ReorgEvents() []ReorgEvent {
+	return ct.reorgEvents
+}
+
+// HeadTimeline returns the head at the start of each round kept
+func (ct *ChainTracker) HeadTimeline() []HeadSnapshot {
+	return ct.headTimeline
+}
+
+// forkCount holds the number of private forks a miner kept at the end of
+// each round from round from on, which prune trims, and their peak and sum
+// over every round counted
+type forkCount struct {
+	series              []int
+	from                int
+	peak, total, rounds int
+}
+
+// countPrivateForks records the private forks the miner kept at the end of
+// round
+func (ct *ChainTracker) countPrivateForks(round, minerID, forks int) {
+	fc := ct.forkCounts[minerID]
+	if fc == nil {
+		fc = &forkCount{from: round}
+		ct.forkCounts[minerID] = fc
+	}
+	fc.series = append(fc.series, forks)
+	if forks > fc.peak {
+		fc.peak = forks
+	}
+	fc.total += forks
+	fc.rounds++
+}
+
+// privateForkSeries returns the number of private forks the miner kept at
+// the end of each round, from the first it was counted in, or under -prune
+// the first kept
+func (ct *ChainTracker) privateForkSeries(minerID int) []int {
+	if fc := ct.forkCounts[minerID]; fc != nil {
+		return fc.series
+	}
+	return nil
+}
+
+// heaviestTipset returns the heaviest of head and the given tipsets, using
+// the chain tracker's tiebreaker between tipsets of equal weight.
+func (ct *ChainTracker) heaviestTipset(head *Tipset, tipsets []*Tipset) *Tipset {
+	prefer := ct.tieBreaker
+	if prefer == nil {
+		prefer = minTicketTieBreaker
+	}
+
+	candidateHead := head
+	for _, ts := range tipsets {
+		if ts.Weight > candidateHead.Weight {
+			candidateHead = ts
+		} else if ts.Weight == candidateHead.Weight {
+			// if of equal weight, let the tiebreaker pick
+			if prefer(ts, candidateHead) {
+				candidateHead = ts
+			}
+		}
+	}
+	return candidateHead
+}
+
+// setHead updates the heaviest tipset seen by the network given the blocks
+// delivered in round, recording a ReorgEvent if the old head is abandoned.
+func (ct *ChainTracker) setHead(round int, blocks []*Block) {
+	tipsets := ct.allTipsets(blocks)
+	candidateHead := ct.heaviestTipset(ct.head, tipsets)
+	if ct.keepsGhostTree() {
+		if ct.ghost == nil {
+			ct.ghost = newGhostTree(ct)
+		}
+		for _, blk := range blocks {
+			ct.ghost.add(blk)
+		}
+		ghost := ct.ghostTipset(ct.head, tipsets)
+		if candidateHead.Name != ghost.Name {
+			ct.forkChoiceDisagreements++
+		}
+		if ct.forkChoice == ghostChoice {
+			candidateHead = ghost
+		}
+	}
+
+	if candidateHead != ct.head {
+		ct.logf(logRounds, "setting head to %s\n", candidateHead.Name)
+		if depth := ct.reorgHead(candidateHead); depth > 0 {
+			ct.logf(logRounds, "reorg of depth %d\n", depth)
+			ct.reorgEvents = append(ct.reorgEvents, ReorgEvent{Round: round, Depth: depth})
+		}
+		ct.head = candidateHead
+		ct.head.WasHead = true
+	}
+	ct.headTimeline = append(ct.headTimeline, HeadSnapshot{Round: round, Head: ct.head.Name, Weight: ct.head.Weight})
+}
+
+// keepsGhostTree reports whether setHead keeps GHOST's block tree: when it
+// picks the head, or to count the rounds it disagrees with heaviest tipset
+func (ct *ChainTracker) keepsGhostTree() bool {
+	return ct.forkChoice == ghostChoice || ct.countDisagreements
+}
+
+// updateView updates the head seen by a single miner given the tipsets
+// delivered to it.
+func (ct *ChainTracker) updateView(minerID int, tipsets []*Tipset) {
+	ct.views[minerID] = ct.heaviestTipset(ct.headFor(minerID), tipsets)
+}
+
+// headFor returns the head as seen by the given miner, falling back to the
+// network's head for miners without a view of their own.
+func (ct *ChainTracker) headFor(minerID int) *Tipset {
+	if view, ok := ct.views[minerID]; ok {
+		return view
+	}
+	return ct.head
+}
+
+// reorgHead moves the InHead markers from the current head's ancestry to the
+// ancestry of newHead: blocks above their common ancestor that drop out of
+// the canonical chain are cleared and those joining it are set.  It returns
+// the number of non-null blocks rolled back, i.e. in the old head's ancestry
+// but not the new one's.
+func (ct *ChainTracker) reorgHead(newHead *Tipset) int {
+	rolledBack := make(map[int]bool)
+	oldTs, newTs := ct.head, newHead
+	for oldTs.Name != newTs.Name {
+		// walk the taller chain back first so both sides meet at the same height
+		if oldTs.getHeight() >= newTs.getHeight() {
+			setInHead(oldTs, false)
+			for _, blk := range oldTs.Blocks {
+				if !blk.Null {
+					rolledBack[blk.Nonce] = true
+				}
+			}
+			oldTs = oldTs.getParents()
+		} else {
+			setInHead(newTs, true)
+			newTs = newTs.getParents()
+		}
+	}
+	// the new chain may share blocks with the old one above the common
+	// ancestor when one tipset is a subset of the other
+	for ts := newHead; ts != newTs; ts = ts.getParents() {
+		for _, blk := range ts.Blocks {
+			delete(rolledBack, blk.Nonce)
+		}
+	}
+	return len(rolledBack)
+}
+
+// setInHead marks the non-null blocks of ts as in or out of the head's ancestry.
+func setInHead(ts *Tipset, inHead bool) {
+	for _, blk := range ts.Blocks {
+		if !blk.Null {
+			blk.InHead = inHead
+		}
+	}
+}
+
+//**** Miner Helpers
+
+func NewRationalMiner(id int, power float64, totalMiners int, ticketSpace uint64, rng *rand.Rand) *RationalMiner {
+	return &RationalMiner{
+		MinerPower:   power,
+		PrivateForks: make(map[string]*Tipset, 0),
+		MinerID:      id,
+		TotalMiners:  totalMiners,
+		TicketSpace:  ticketSpace,
+		Rand:         rng,
+	}
+}
+
+// ID returns the miner's identifier
+func (m *RationalMiner) ID() int {
+	return m.MinerID
+}
+
+// Power returns the miner's fraction of total network power
+func (m *RationalMiner) Power() float64 {
+	return m.MinerPower
+}
+
+// Adversarial returns whether the miner is tagged as an adversary
+func (m *RationalMiner) Adversarial() bool {
+	return m.Adversary
+}
+
+// Bootstrap replaces the miner's private forks with head alone
+func (m *RationalMiner) Bootstrap(head *Tipset) {
+	m.PrivateForks = map[string]*Tipset{head.Name: head}
+}
+
+// generateBlock makes a new block with the given parents, drawing its
+// election proof from the lookback in effect at the parents' height
+// note that while it uses a "null block abstraction" rather than ticket arrays as in
+// the spec, the result is the same for consensus.
+// To that end, we use separate tickets for new ticket generation and election proof generation
+// in case there is randomness skew (though can't think of what it would be rn)
+func (m *RationalMiner) generateBlock(ct *ChainTracker, parents *Tipset) *Block {
+	// Given parents and id we have a unique source for new ticket
+	lotteryTicket := ct.lookback(parents, ct.lbps.at(parents.getHeight())).MinTicket
+	nextBlock := m.nullBlock(ct, parents)
+
+	ct.attempts[nextBlock.Height]++
+
+	// check lotteryTicket to see if the block can be published
+	electionProof := m.generateTicket(lotteryTicket)
+	nextBlock.WinCount = electionWins(m.Election, electionProof, m.MinerPower*ct.difficulty, m.TicketSpace)
+	if m.Oracle != nil {
+		if wins, ok := m.Oracle.Wins(m.MinerID, nextBlock.Height); ok {
+			nextBlock.WinCount = wins
+		}
+	}
+	nextBlock.Null = nextBlock.WinCount == 0
+	if !nextBlock.Null {
+		nextBlock.ElectionProof = electionProof
+		ct.wins[nextBlock.Height]++
+	}
+
+	return nextBlock
+}
+
+// nullBlock makes the miner's null block atop parents, before any election
+// is run for it
+func (m *RationalMiner) nullBlock(ct *ChainTracker, parents *Tipset) *Block {
+	lastTicket := lookbackTipset(parents, 1).MinTicket
+
+	// Also need live parents off of which to calculate new weight
+	liveParents := parents
+	if parents.Blocks[0].Null {
+		// null blocks will only ever be in single-block tipsets so this works
+		liveParents = parents.Blocks[0].liveParents()
+	}
+
+	// generate a new ticket from parent tipset
+	t := m.generateTicket(lastTicket)
+	// include in new block
+	return &Block{
+		Nonce:        ct.newNonce(),
+		Parents:      parents,
+		Owner:        m.MinerID,
+		Height:       parents.getHeight() + 1,
+		ParentWeight: liveParents.Weight,
+		Seed:         t,
+		InHead:       false,
+		// null parents still take up a round, so time advances with them
+		Timestamp: parents.Blocks[0].Timestamp + m.BlockTime,
+		Null:      true,
+	}
+}
+
+// generateTicket, simulates a VRF
+func (m *RationalMiner) generateTicket(minTicket uint64) uint64 {
+	// keyed hash of the ticket and miner id: distinct inputs give
+	// well-distributed tickets rather than colliding whenever
+	// minTicket + id sums are equal
+	var msg [16]byte
+	binary.BigEndian.PutUint64(msg[:8], minTicket)
+	binary.BigEndian.PutUint64(msg[8:], uint64(m.MinerID))
+	mac := hmac.New(sha256.New, msg[8:])
+	mac.Write(msg[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil)) % m.TicketSpace
+}
+
+func (m *RationalMiner) ConsiderAllForks(atsforks [][]*Tipset) {
+	// rational miner strategy look for all potential minblocks there
+	for _, forks := range atsforks {
+		for _, ts := range forks {
+			m.PrivateForks[ts.Name] = ts
+		}
+	}
+}
+
+// dropLightForks keeps only the miner's MaxForks heaviest private forks,
+// heaviest first and then in name order, if it has more
+func (m *RationalMiner) dropLightForks() {
+	if m.MaxForks <= 0 || len(m.PrivateForks) <= m.MaxForks {
+		return
+	}
+	names := forkNames(m.PrivateForks)
+	sort.SliceStable(names, func(i, j int) bool {
+		return m.PrivateForks[names[i]].Weight > m.PrivateForks[names[j]].Weight
+	})
+	for _, name := range names[m.MaxForks:] {
+		delete(m.PrivateForks, name)
+	}
+}
+
+// forkNames returns the names of forks sorted, so that miners visit their
+// private forks in the same order on every run with the same seed
+func forkNames(forks map[string]*Tipset) []string {
+	names := make([]string, 0, len(forks))
+	for name := range forks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Input the base tipset for mining lookbackTipset will return the ancestor
+// tipset that should be used for sampling the leader election seed.
+// On LBP == 1, returns itself (as in no farther than direct parents)
+// makeGen builds enough genesis ancestors for the largest lookback used, but
+// should the walk run out of ancestors it clamps at the first one rather than
+// following a nil parent.
+func lookbackTipset(tipset *Tipset, lbp int) *Tipset {
+	for i := 0; i < lbp-1; i++ {
+		parents := tipset.getParents()
+		if parents == nil {
+			break
+		}
+		tipset = parents
+	}
+	return tipset
+}
+
+// lookbackKey identifies a lookback from a tipset
+type lookbackKey struct {
+	name string
+	lbp  int
+}
+
+// lookback returns lookbackTipset(tipset, lbp), caching it by the tipset's
+// name and lbp.  Miners share forks, so all but the first skip the walk
+// back; only lookbacks from the latest height looked up are kept.
+func (ct *ChainTracker) lookback(tipset *Tipset, lbp int) *Tipset {
+	if lbp <= 1 {
+		return tipset
+	}
+	if h := tipset.getHeight(); h != ct.lookbackHeight {
+		ct.lookbacks = make(map[lookbackKey]*Tipset)
+		ct.lookbackHeight = h
+	}
+	key := lookbackKey{name: tipset.Name, lbp: lbp}
+	if ts, ok := ct.lookbacks[key]; ok {
+		return ts
+	}
+	ts := lookbackTipset(tipset, lbp)
+	ct.lookbacks[key] = ts
+	return ts
+}
+
+func isWinningTicket(ticket uint64, power float64, ticketSpace uint64) bool {
+	// this is a simulation of ticket checking: the ticket is drawn uniformly from 0 to ticketSpace
+	// If it is smaller than that * the miner's power (between 0 and 1), it wins.
+	// Powers given as hash rates are normalized to this fraction beforehand.
+	return float64(ticket) < float64(ticketSpace)*power
+}
+
+//**** Main logic
+
+// Mine outputs the block that a miner mines in a round where the leaves of
+// the block tree are given by newBlocks.  A miner will only ever mine one
+// block in a round because if it mines two or more it gets slashed, unless
+// it takes the Risk of publishing the others too.
+func (m *RationalMiner) Mine(ct *ChainTracker, atsforks [][]*Tipset) *Block {
+	// Start by combining existing pforks and new blocks available to mine
+	// atop of.  If every miner mined a null block last round there are no
+	// new blocks, and the forks headed by the miner's null blocks are all it
+	// extends.
+	m.ConsiderAllForks(atsforks)
+	m.dropLightForks()
+
+	var nullBlocks []*Block
+	var winners []*Block
+	maxWeight := 0
+	var bestBlock *Block
+	ct.logf(logMiners, "miner %d. number of priv forks: %d\n", m.MinerID, len(m.PrivateForks))
+	// among equally heavy forks the first in name order wins
+	for _, k := range forkNames(m.PrivateForks) {
+		// generateBlock takes in a block's parent tipset, as in current head of PrivateForks
+		blk := m.generateBlock(ct, m.PrivateForks[k])
+		if !blk.Null {
+			winners = append(winners, blk)
+		}
+		if !blk.Null && blk.ParentWeight > maxWeight {
+			bestBlock = blk
+			maxWeight = blk.ParentWeight
+		} else if blk.Null && bestBlock == nil {
+			// if blk is null and we haven't found a winning block yet
+			// we will want to extend private forks with it
+			// no need to do it if blk is not null since the pforks will get deleted anyways
+			nullBlocks = append(nullBlocks, blk)
+
+			// we will also want to add this null block to the set of allBlocks we track
+			// this will allow us to reform full history in case a winning block is
+			// mined off of the null block
+			ct.allBlocks[blk.Nonce] = blk
+		}
+	}
+
+	// if bestBlock is not null
+	if bestBlock != nil {
+		// kill all pforks
+		m.PrivateForks = make(map[string]*Tipset)
+		// risk being slashed for publishing the other winning blocks too
+		if len(winners) > 1 && m.Risk > 0 && m.Rand.Float64() < m.Risk {
+			for _, blk := range winners {
+				if blk != bestBlock {
+					ct.equivocations = append(ct.equivocations, blk)
+				}
+			}
+			ct.logf(logMiners, "miner %d. equivocating with %d blocks\n", m.MinerID, len(winners))
+		}
+	} else {
+		// extend null block chain
+		for _, nblk := range nullBlocks {
+			delete(m.PrivateForks, nblk.Parents.Name)
+			// add the new null block to our private forks
+			nullTipset := ct.NewTipset([]*Block{nblk})
+			m.PrivateForks[nullTipset.Name] = nullTipset
+		}
+	}
+	return bestBlock
+}
+
+// simConfig holds the parameters shared by every trial of a run
+type simConfig struct {
+	totalMiners int
+	rounds      int
+	// lookback parameter in effect at each height
+	lbps lbpSchedule
+	// fraction of miners following the honest strategy
+	honestFrac float64
+	// power of each miner, as a fraction of network power
+	powers []float64
+	// absolute hash rate of each miner that powers normalizes, if powers
+	// were given as hash rates
+	hashRates []float64
+	// optional network partition
+	partitions *PartitionSchedule
+	// optional network topology delaying blocks between miners, built for
+	// each trial
+	topology topologyFactory
+	// tickets are drawn uniformly from [0, ticketSpace)
+	ticketSpace uint64
+	// fraction of miners, taken from the highest IDs, tagged as adversaries
+	adversaryFrac float64
+	// reward paid for each block in the canonical chain
+	blockReward float64
+	// transactions carried by each block
+	txPerBlock int
+	// how election proofs are turned into wins
+	election electionRule
+	// optional scripted election outcomes, overriding the ticket draw
+	oracle ElectionOracle
+	// duration of a round
+	blockTime time.Duration
+	// fork choice rule between tipsets of equal weight, built for the
+	// trial's miners
+	tieBreaker tieBreakerFactory
+	// rule picking the network's head
+	forkChoice forkChoiceRule
+	// whether to count the rounds in which GHOST and heaviest tipset would
+	// pick different heads
+	disagreements bool
+	// name of the weight function tipsets are weighed with, see -weight
+	weight string
+	// cap on the blocks of a tipset, 0 for no cap, see -maxTipsetSize
+	maxTipsetSize int
+	// how the winning threshold changes over time
+	difficulty difficultyRule
+	// if set, seeds the tickets of genesis and its ancestors, which are
+	// otherwise random
+	genesisSeed *int64
+	// if positive, prune the chain every prune rounds, keeping prune
+	// heights below the head
+	prune int
+	// strategy followed by the adversaries, if any: "balance", "reorg" or
+	// "" to leave them honest or rational
+	attack string
+	// number of canonical blocks reorg attackers try to rewrite
+	reorgDepth int
+	// private forks rational miners mine on, heaviest first (0 for all),
+	// and probability they equivocate when winning on several
+	maxForks int
+	risk     float64
+	// penalty paid for each slashable equivocation
+	slashPenalty float64
+	// relative weight of each miner strategy, overriding honestFrac and
+	// attack if set
+	mix StrategyMix
+	// optional stream of per-round events
+	events *eventWriter
+	// optional miners joining and leaving over time
+	churn ChurnSchedule
+	// level of the log, see logf, and whether to validate every tipset as
+	// it is built
+	verbosity int
+	strict    bool
+}
+
+// runSim runs a single trial whose miners draw from RNGs derived from seed.
+// Miners follow the strategies of the config's mix, or else the first
+// honestFrac of them are honest and the rest rational.  It returns an error
+// if the chain breaks one of the invariants the simulation relies on.
+func runSim(cfg *simConfig, seed int64) (*ChainTracker, error) {
+	totalMiners, roundNum := cfg.totalMiners, cfg.rounds
+
+	mix := cfg.mix
+	if mix == nil {
+		mix = cfg.defaultMix()
+	}
+	chainTracker := NewChainTracker(cfg.buildMiners(mix, cfg.powers, seed))
+	chainTracker.lbps = cfg.lbps
+	chainTracker.ticketSpace = cfg.ticketSpace
+	chainTracker.blockReward = cfg.blockReward
+	chainTracker.txPerBlock = cfg.txPerBlock
+	chainTracker.slashPenalty = cfg.slashPenalty
+	chainTracker.blockTime = cfg.blockTime
+	chainTracker.tieBreaker = cfg.tieBreaker(chainTracker.miners)
+	chainTracker.forkChoice = cfg.forkChoice
+	chainTracker.countDisagreements = cfg.disagreements
+	chainTracker.verbosity = cfg.verbosity
+	chainTracker.strict = cfg.strict
+	if err := chainTracker.setWeight(cfg.weight); err != nil {
+		return nil, err
+	}
+	chainTracker.maxTipsetSize = cfg.maxTipsetSize
+	chainTracker.topology = cfg.buildTopology(totalMiners, seed)
+	// genesis needs enough ancestors for the largest lookback used.  Its
+	// tickets come from the trial seed like the miners' do, as if drawn by
+	// its owner -1, unless pinned by the config.
+	genSource := randSource{rng: minerRand(seed, -1)}
+	if cfg.genesisSeed != nil {
+		genSource = seededSource(*cfg.genesisSeed)
+	}
+	gen, err := makeGen(chainTracker, cfg.lbps.max(), totalMiners, cfg.ticketSpace, genSource)
+	if err != nil {
+		return nil, err
+	}
+	chainTracker.head = chainTracker.NewTipset([]*Block{gen})
+
+	pending, err := runRounds(cfg, chainTracker, seed, []*Block{gen}, 0, roundNum)
+	if err != nil {
+		return nil, err
+	}
+	// height is 0 indexed
+	chainTracker.maxHeight = roundNum - 1
+	chainTracker.pending = pending
+	if err := verifyHeadConsistency(chainTracker); err != nil {
+		return nil, err
+	}
+	if cfg.strict {
+		if err := verifyWeightMonotonic(chainTracker); err != nil {
+			return nil, err
+		}
+	}
+	return chainTracker, nil
+}
+
+// runRounds runs rounds from up to (but excluding) to, starting with blocks
+// delivered in round from.  It returns the blocks mined in the last round,
+// which are yet to be delivered, or an error if a block is delivered at the
+// wrong height or, under -strict, a tipset breaks the invariants.
+func runRounds(cfg *simConfig, chainTracker *ChainTracker, seed int64, blocks []*Block, from, to int) ([]*Block, error) {
+	miners := chainTracker.miners
+	active := cfg.churn.activeAt(miners, from)
+	var queue *deliveryQueue
+	if chainTracker.topology != nil {
+		queue = newDeliveryQueue(chainTracker.topology)
+	}
+	// Throughout we represent chains (or forks) as arrays of arrays of Tipsets.
+	// Tipsets are possible sets of blocks to mine of off in a given round.
+	// Arrays of tipsets represent the multiple choices a miner has in a given
+	//     round for a given chain.
+	// Arrays of arrays of tipsets represent each chain/fork.
+	for round := from; round < to; round++ {
+		// Update heaviest chain
+		chainTracker.setHead(round, blocks)
+		cfg.events.emitEvent(chainTracker, seed, round, blocks)
+
+		// Cache live blocks for future stats
+		for _, blk := range blocks {
+			chainTracker.allBlocks[blk.Nonce] = blk
+		}
+
+		// Every miner extends each of its forks by one block, null or not,
+		// every round, so blocks delivered in a round are at the round's
+		// height even when the previous rounds produced only null blocks.
+		if len(blocks) == 0 {
+			// every miner mined a null block last round: nothing is
+			// delivered, the head stays put and miners extend their null
+			// blocks, which are at this round's height
+			chainTracker.logf(logRounds, "round %d delivers no blocks\n", round)
+		} else {
+			chainTracker.liveBlocksByHeight[round] = blocks
+		}
+		for _, blk := range blocks {
+			if blk.Height != round {
+				return nil, fmt.Errorf("block %d at height %d delivered in round %d", blk.Nonce, blk.Height, round)
+			}
+		}
+		if cfg.prune > 0 && round > 0 && round%cfg.prune == 0 {
+			blocks = chainTracker.pruneSampled(cfg.prune, blocks)
+		}
+
+		chainTracker.logf(logRounds, "%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%\n")
+		chainTracker.logf(logRounds, "Round %d -- %d new blocks\n", round, len(blocks))
+		for _, blk := range blocks {
+			chainTracker.logf(logBlocks, "b%d (m%d)\t", blk.Nonce, blk.Owner)
+		}
+		chainTracker.logf(logBlocks, "\n")
+		chainTracker.logf(logRounds, "%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%%\n")
+		var newBlocks = []*Block{}
+
+		// Blocks are delivered to each group of miners that can see them,
+		// and on to each miner through the topology if there is one
+		delivered := cfg.partitions.deliver(round, blocks)
+		groupTipsets := make(map[string][]*Tipset, len(delivered))
+		groupForks := make(map[string][][]*Tipset, len(delivered))
+		for g, gblocks := range delivered {
+			if queue != nil {
+				// each miner groups the blocks reaching it itself
+				continue
+			}
+			ats := chainTracker.allTipsets(gblocks)
+			groupTipsets[g] = ats
+			for _, v := range ats {
+				groupForks[g] = append(groupForks[g], chainTracker.forksFromTipset(v))
+			}
+		}
+
+		// Miners join and leave
+		if cfg.churn != nil && (round == from || cfg.churn.changesAt(round)) {
+			now := cfg.churn.activeAt(miners, round)
+			for _, m := range miners {
+				if now[m.ID()] && !active[m.ID()] {
+					rejoin(chainTracker, m, round)
+				}
+			}
+			active = now
+			renormalizePowers(chainTracker, miners, cfg.powers, active, round)
+		}
+
+		for _, m := range miners {
+			if !active[m.ID()] {
+				continue
+			}
+			g := ""
+			if cfg.partitions.splits(round) {
+				g = cfg.partitions.group(m.ID())
+			}
+			tipsets, forks := groupTipsets[g], groupForks[g]
+			if queue != nil {
+				queue.send(m.ID(), round, delivered[g])
+				tipsets, forks = queue.receive(chainTracker, m, round)
+			}
+			view := chainTracker.headFor(m.ID())
+			chainTracker.updateView(m.ID(), tipsets)
+			if now := chainTracker.headFor(m.ID()); now != view && now.getHeight() < round {
+				// a head that arrived late is mined on atop the miner's null
+				// blocks, like its forks are
+				chainTracker.views[m.ID()] = rationalMiner(m).catchUp(chainTracker, now, round)
+			}
+
+			// Each miner mines
+			blk := m.Mine(chainTracker, forks)
+			if blk != nil {
+				newBlocks = append(newBlocks, blk)
+			}
+			newBlocks = append(newBlocks, chainTracker.equivocations...)
+			chainTracker.equivocations = nil
+		}
+		newBlocks = append(newBlocks, chainTracker.reorgPool.endRound(chainTracker)...)
+		for _, m := range miners {
+			id := m.ID()
+			chainTracker.countPrivateForks(round, id, len(rationalMiner(m).PrivateForks))
+		}
+		chainTracker.distinctHeads = append(chainTracker.distinctHeads, len(minersByHead(chainTracker)))
+		// NewBlocks added to network
+		chainTracker.logf(logMiners, "\n")
+		chainTracker.blocksPerRound = append(chainTracker.blocksPerRound, len(newBlocks))
+		// blocks withheld or mined by no one count alike in blocksPerRound,
+		// but only the latter stall the network
+		if chainTracker.wins[round+1] == 0 {
+			chainTracker.stalls++
+		}
+		chainTracker.adjustDifficulty(cfg.difficulty)
+		blocks = newBlocks
+		if err := chainTracker.strictErr; err != nil {
+			return nil, fmt.Errorf("round %d: %s", round, err)
+		}
+	}
+	if cfg.prune > 0 {
+		chainTracker.sampleHeap()
+	}
+	return blocks, nil
+}
+
+// trialResult is the outcome of trial n run by runTrials
+type trialResult struct {
+	n    int
+	ct   *ChainTracker
+	seed int64
+	err  error
+}
+
+// runTrials runs trials of the simulation in parallel and returns their
+// chain trackers in trial order, so that the chain of trial n is cts[n]
+// whichever finishes first.  Trial n is seeded with seedFor(n), or
+// randomly if seedFor is nil.  Unless quiet, suites report their progress.
+// If any trial fails, the error of the earliest to fail is returned once
+// all have finished.
+func runTrials(cfg *simConfig, trials int, seedFor func(n int) int64, quiet bool) ([]*ChainTracker, error) {
+	cts := make([]*ChainTracker, trials)
+	err := streamTrials(cfg, trials, seedFor, quiet, trials, func(n int, ct *ChainTracker) { cts[n] = ct })
+	if err != nil {
+		return nil, err
+	}
+	return cts, nil
+}
+
+// streamTrials runs trials of the simulation in parallel like runTrials,
+// but hands each trial's chain to observe in trial order instead of keeping
+// it.  At most window trials are running or waiting for an earlier one to
+// finish at once, so that no more than window chains are held however many
+// trials are run.
+func streamTrials(cfg *simConfig, trials int, seedFor func(n int) int64, quiet bool, window int, observe func(n int, ct *ChainTracker)) error {
+	// unseeded trials draw their seeds up front, so that failing to draw
+	// one leaves no trial running
+	seeds := make([]int64, trials)
+	for n := range seeds {
+		if seedFor != nil {
+			seeds[n] = seedFor(n)
+			continue
+		}
+		var err error
+		if seeds[n], err = newSeed(); err != nil {
+			return fmt.Errorf("seed of trial %d: %s", n, err)
+		}
+	}
+
+	var firstErr error
+	c := make(chan trialResult, trials)
+	prog := newProgress(trials)
+	if trials > 1 && !quiet {
+		go prog.run(progressInterval)
+	}
+	launch := func(n int) {
+		seed := seeds[n]
+		reportf("Trial %d (seed %d)\n", n, seed)
+		reportf("-*-*-*-*-*-*-*-*-*-*-\n")
+		go func(n int, seed int64) {
+			ct, err := runSim(cfg, seed)
+			c <- trialResult{n: n, ct: ct, seed: seed, err: err}
+		}(n, seed)
+	}
+
+	// trials that finished ahead of an earlier one, by trial
+	finished := make(map[int]trialResult)
+	launched := 0
+	for next := 0; next < trials; {
+		for ; launched < trials && launched-next < window; launched++ {
+			launch(launched)
+		}
+		result := <-c
+		prog.finish()
+		finished[result.n] = result
+		for {
+			result, ok := finished[next]
+			if !ok {
+				break
+			}
+			delete(finished, next)
+			next++
+			if result.err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("trial with seed %d: %s", result.seed, result.err)
+				}
+				continue
+			}
+			observe(result.n, result.ct)
+		}
+	}
+	prog.close()
+	return firstErr
+}
+
+//**** IO
+
+// writeChain output a json from which you can rebuild your chain tracker
+func writeChain(ct *ChainTracker, name string, outputDir string) {
+	reportf("Writing Out %s\n", name)
+	if err := verifyTrackerConsistency(ct); err != nil {
+		reportf("warning: chain %s is incomplete: %s\n", name, err)
+	}
+
+	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+		reportf("HERE")
+		err2 := os.MkdirAll(outputDir, 0755)
+		if err2 != nil {
+			panic(err2)
+		}
+	}
+
+	fil, err := os.Create(fmt.Sprintf("%s/%s.json", outputDir, name))
+	if err != nil {
+		panic(err)
+	}
+	defer fil.Close()
+
+	// What do we need?
+	// 1. Nodes: All blocks, including their details.
+	// 2. Edges: Included in Node pointer to Tipset
+
+	// open JSON block
+	fmt.Fprintln(fil, "{")
+
+	// sorted so that the same chain is always written out the same way
+	blocks := make([]*Block, 0, len(ct.allBlocks))
+	for _, value := range ct.allBlocks {
+		blocks = append(blocks, value)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Nonce < blocks[j].Nonce })
+	// miners build their own copies of a tipset, only one of which is
+	// marked when it becomes head; the loader merges them, so mark them
+	// all alike for the chain to be written back the same way
+	wasHead := map[string]bool{ct.head.Name: true}
+	for _, snap := range ct.headTimeline {
+		wasHead[snap.Head] = true
+	}
+	for _, blk := range blocks {
+		if blk.Parents != nil && blk.Parents.WasHead {
+			wasHead[blk.Parents.Name] = true
+		}
+	}
+	for _, blk := range blocks {
+		if blk.Parents != nil && wasHead[blk.Parents.Name] {
+			blk.Parents.WasHead = true
+		}
+	}
+
+	marshalledBlocks, err := json.MarshalIndent(blocks, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintln(fil, "\"blocks\":")
+	fmt.Fprintln(fil, string(marshalledBlocks))
+	fmt.Fprintln(fil, ",")
+
+	// 3. Miners: All minersV
+	// This should appropriately capture tipsets as well as full tree.
+	// TODO: some form of checksumming for this data (e.g. some stats about tispets or heads over time)
+	miners := append([]Miner(nil), ct.miners...)
+	sort.Slice(miners, func(i, j int) bool { return miners[i].ID() < miners[j].ID() })
+	marshalledMiners, err := json.MarshalIndent(miners, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintln(fil, "\"miners\":")
+	fmt.Fprintln(fil, string(marshalledMiners))
+	fmt.Fprintln(fil, ",")
+
+	// 4. Genesis ancestors: not part of the chain but needed to rebuild
+	// lookback tickets when reading the chain back in.  In a pruned chain
+	// these also hold the canonical chain below the oldest block kept.
+	ancestors := []*Block{}
+	for ts := ct.liveBlocksByHeight[ct.prunedBelow][0].Parents; ts != nil; ts = ts.getParents() {
+		ancestors = append(ancestors, ts.Blocks...)
+	}
+	marshalledAncestors, err := json.MarshalIndent(ancestors, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintln(fil, "\"genesis\":")
+	fmt.Fprintln(fil, string(marshalledAncestors))
+	fmt.Fprintln(fil, ",")
+
+	// 5. Blocks mined in the last round, needed to resume the chain
+	marshalledPending, err := json.MarshalIndent(ct.pending, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintln(fil, "\"pending\":")
+	fmt.Fprintln(fil, string(marshalledPending))
+	fmt.Fprintln(fil, ",")
+
+	// 6. Head at the start of every round
+	marshalledTimeline, err := json.MarshalIndent(ct.headTimeline, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintln(fil, "\"headTimeline\":")
+	fmt.Fprintln(fil, string(marshalledTimeline))
+	fmt.Fprintln(fil, ",")
+
+	// 7. Chain parameters and final head
+	marshalledLBPs, err := json.Marshal(ct.lbps)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(fil, "\"lbp\": %d,\n", ct.lbps.at(0))
+	fmt.Fprintf(fil, "\"lbpSchedule\": %s,\n", marshalledLBPs)
+	fmt.Fprintf(fil, "\"ticketSpace\": %d,\n", ct.ticketSpace)
+	fmt.Fprintf(fil, "\"weight\": %q,\n", ct.weightName)
+	fmt.Fprintf(fil, "\"maxTipsetSize\": %d,\n", ct.maxTipsetSize)
+	fmt.Fprintf(fil, "\"forkChoice\": %q,\n", ct.forkChoice)
+	fmt.Fprintf(fil, "\"blockTime\": %d,\n", ct.blockTime)
+	marshalledAttempts, err := json.Marshal(ct.attempts)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(fil, "\"attempts\": %s,\n", marshalledAttempts)
+	marshalledWins, err := json.Marshal(ct.wins)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(fil, "\"wins\": %s,\n", marshalledWins)
+	marshalledDifficulties, err := json.Marshal(ct.difficulties)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(fil, "\"difficultySeries\": %s,\n", marshalledDifficulties)
+	marshalledHeads, err := json.Marshal(ct.distinctHeads)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(fil, "\"distinctHeads\": %s,\n", marshalledHeads)
+	fmt.Fprintf(fil, "\"difficulty\": %g,\n", ct.difficulty)
+	fmt.Fprintf(fil, "\"prunedBelow\": %d,\n", ct.prunedBelow)
+	fmt.Fprintf(fil, "\"maxHeight\": %d,\n", ct.maxHeight)
+	fmt.Fprintf(fil, "\"head\": %q\n", ct.head.Name)
+
+	// close JSON block
+	fmt.Fprintln(fil, "}")
+}
+
+// drawChain output a dot graph of the entire blockchain generated by the simulation
+func drawChain(ct *ChainTracker, name string, outputDir string) {
+	reportf("Drawing Graph %s\n", name)
+	if err := verifyTrackerConsistency(ct); err != nil {
+		reportf("warning: chain %s is incomplete: %s\n", name, err)
+	}
+
+	fil, err := os.Create(fmt.Sprintf("%s/%s.dot", outputDir, name))
+	if err != nil {
+		panic(err)
+	}
+	defer fil.Close()
+
+	if ct.prunedBelow == 0 {
+		reportf("at height 0, blocks: %d\n", len(ct.liveBlocksByHeight[0]))
+	}
+	writeDot(fil, ct, ct.maxHeight, func(block *Block) bool { return block.InHead })
+}
+
+// writeDot writes the dot graph of the blocks up to height top, highlighting
+// those for which inHead returns true
+func writeDot(fil io.Writer, ct *ChainTracker, top int, inHead func(*Block) bool) {
+	fmt.Fprintln(fil, "digraph G {")
+	fmt.Fprintln(fil, "\t{\n\t\tnode [shape=plaintext];")
+
+	// Write out height index alongside the block graph
+	fmt.Fprintf(fil, "\t\t%d", ct.prunedBelow)
+	// Start one above because we already wrote out the lowest height for the .dot file
+	for cur := ct.prunedBelow + 1; cur <= top+1; cur++ {
+		fmt.Fprintf(fil, " -> %d", cur)
+	}
+	fmt.Fprintln(fil, ";")
+	// label heights with the time at which they were mined
+	if ct.blockTime > 0 {
+		for cur := ct.prunedBelow; cur <= top+1; cur++ {
+			fmt.Fprintf(fil, "\t\t%d [label=\"%d\\n%s\"];\n", cur, cur, time.Duration(cur)*ct.blockTime)
+		}
+	}
+	fmt.Fprintln(fil, "\t}")
+
+	fmt.Fprintln(fil, "\tnode [shape=box];")
+	// Write out the actual blocks
+	for cur := top; cur >= ct.prunedBelow; cur-- {
+		// get blocks per height
+		blocks, ok := ct.liveBlocksByHeight[cur]
+
+		// if no blocks at height, skip
+		if !ok {
+			continue
+		}
+
+		// for every block at this height
+		fmt.Fprintf(fil, "\t{ rank = same; %d;", cur)
+
+		for _, block := range blocks {
+			// print block
+			if inHead(block) {
+				fmt.Fprintf(fil, " \"b%d (m%d)\" [color=\"red\", style=\"bold\"];", block.Nonce, block.Owner)
+			} else {
+				fmt.Fprintf(fil, " \"b%d (m%d)\";", block.Nonce, block.Owner)
+			}
+		}
+		fmt.Fprintln(fil, " }")
+
+		// link to parents
+		for _, l := range ct.parentLinks(blocks) {
+			fmt.Fprintf(fil, "\t\"b%d (m%d)\" -> \"b%d (m%d)\";\n", l.child.Nonce, l.child.Owner, l.parent.Nonce, l.parent.Owner)
+		}
+	}
+
+	fmt.Fprintln(fil, "}")
+}
@@ -0,0 +1,731 @@
+package sim
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testConfig returns the config of a run with the default flags for the
+// given number of miners, rounds and lookback
+func testConfig(t testing.TB, miners, rounds, lbp int) *simConfig {
+	powers, hashRates, err := minerPowers(miners, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &simConfig{
+		totalMiners: miners,
+		rounds:      rounds,
+		lbps:        constantLBP(lbp),
+		powers:      powers,
+		hashRates:   hashRates,
+		ticketSpace: bigOlNum,
+		blockReward: 1,
+		blockTime:   30 * time.Second,
+		tieBreaker:  fixedTieBreaker(minTicketTieBreaker),
+	}
+}
+
+// testGen makes the genesis block of ct and its lbp-1 ancestors, with
+// tickets seeded for the given number of miners
+func testGen(t testing.TB, ct *ChainTracker, lbp, miners int) *Block {
+	gen, err := makeGen(ct, lbp, miners, bigOlNum, seededSource(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gen
+}
+
+// checkGolden compares got to the golden file testdata/name, rewriting it
+// instead under -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file, got:\n%s", path, got)
+	}
+}
+
+func TestDrawChainGolden(t *testing.T) {
+	sim, err := runSim(testConfig(t, 8, 20, 3), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := buildScenario(reorgScenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		ct   *ChainTracker
+	}{
+		{"sim", sim},
+		{"reorg", scenario},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			drawChain(tc.ct, tc.name, dir)
+			got, err := os.ReadFile(filepath.Join(dir, tc.name+".dot"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "drawchain_"+tc.name+".dot", got)
+		})
+	}
+}
+
+func TestReorgHeadMarksOnlyFinalAncestry(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		spec   string
+		depths []int
+	}{
+		{"no reorg", "round 1: m0, m1; round 2: m0; round 3: m1 null, m2", nil},
+		{"single reorg", reorgScenario, []int{2}},
+		{"reorg and back", `round 1: a1=m0 on genesis, n1=m1 null on genesis
+round 2: a2=m0 on a1, b2=m1 on n1
+round 3: b3=m1 on b2, b3x=m2 on b2, an3=m0 null on a2
+round 4: m0 on an3, m3 on an3, m4 on an3, m1 on b3+b3x`, []int{2, 3}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ct, err := buildScenario(tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var depths []int
+			for _, ev := range ct.reorgEvents {
+				depths = append(depths, ev.Depth)
+			}
+			if fmt.Sprint(depths) != fmt.Sprint(tc.depths) {
+				t.Errorf("reorg depths %v, want %v", depths, tc.depths)
+			}
+			ancestry := headAncestry(ct)
+			for _, blk := range ct.allBlocks {
+				if !blk.Null && blk.InHead != ancestry[blk.Nonce] {
+					t.Errorf("block %d (m%d at height %d) has InHead %t, want %t", blk.Nonce, blk.Owner, blk.Height, blk.InHead, ancestry[blk.Nonce])
+				}
+			}
+		})
+	}
+}
+
+func TestRunTrialsKeepsTrialOrder(t *testing.T) {
+	cfg := testConfig(t, 6, 30, 2)
+	// trials run in parallel and finish in any order
+	seedFor := func(n int) int64 { return int64(100 + n) }
+	cts, err := runTrials(cfg, 8, seedFor, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, ct := range cts {
+		want, err := runSim(cfg, seedFor(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct.head.Name != want.head.Name || len(ct.allBlocks) != len(want.allBlocks) {
+			t.Errorf("cts[%d] has head %s and %d blocks, want trial %d's %s and %d", n, ct.head.Name, len(ct.allBlocks), n, want.head.Name, len(want.allBlocks))
+		}
+	}
+}
+
+func TestStreamTrialsInTrialOrder(t *testing.T) {
+	cfg := testConfig(t, 6, 30, 2)
+	seedFor := func(n int) int64 { return int64(100 + n) }
+	for _, window := range []int{1, 3, 8} {
+		t.Run(fmt.Sprint("window=", window), func(t *testing.T) {
+			var order []int
+			err := streamTrials(cfg, 8, seedFor, true, window, func(n int, ct *ChainTracker) {
+				order = append(order, n)
+				want, err := runSim(cfg, seedFor(n))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := diffRuns(ct, want); err != nil {
+					t.Errorf("trial %d: %s", n, err)
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(order); got != "[0 1 2 3 4 5 6 7]" {
+				t.Errorf("trials observed in order %s", got)
+			}
+		})
+	}
+}
+
+// TestRunTrialsNoncesPerTrial runs trials side by side, as runTrials does,
+// so that go test -race catches any nonce counter they share
+func TestRunTrialsNoncesPerTrial(t *testing.T) {
+	cfg := testConfig(t, 8, 40, 3)
+	cfg.honestFrac = 0.5
+	seedFor := func(n int) int64 { return 7 }
+	cts, err := runTrials(cfg, 6, seedFor, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := runSim(cfg, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, ct := range cts {
+		// every trial numbers its blocks from 0, whatever the others do
+		if ct.nextNonce != want.nextNonce {
+			t.Errorf("trial %d used %d nonces, want %d", n, ct.nextNonce, want.nextNonce)
+		}
+		if err := diffRuns(ct, want); err != nil {
+			t.Errorf("trial %d: %s", n, err)
+		}
+	}
+}
+
+func TestGenerateTicketNoCollisions(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		minTickets    []uint64
+		miners        int
+		ticketSpace   uint64
+		maxCollisions int
+	}{
+		// minTicket + ID sums repeat all over these grids
+		{"square grid", seq(0, 200), 200, 1 << 62, 0},
+		{"many miners", seq(0, 10), 5000, 1 << 62, 0},
+		{"large tickets", seq(1<<63-100, 100), 100, 1 << 62, 0},
+		// 10000 draws from bigOlNum collide ~500 times by the birthday
+		// bound; sums of a seeded RNG collide on every repeated sum
+		{"default space", seq(0, 100), 100, bigOlNum, 600},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			seen := make(map[uint64]bool)
+			collisions := 0
+			for id := 0; id < tc.miners; id++ {
+				m := NewRationalMiner(id, 0, tc.miners, tc.ticketSpace, nil)
+				for _, min := range tc.minTickets {
+					ticket := m.generateTicket(min)
+					if ticket >= tc.ticketSpace {
+						t.Fatalf("ticket %d out of space %d", ticket, tc.ticketSpace)
+					}
+					if seen[ticket] {
+						collisions++
+					}
+					seen[ticket] = true
+				}
+			}
+			if collisions > tc.maxCollisions {
+				t.Errorf("%d collisions among %d tickets, want at most %d", collisions, tc.miners*len(tc.minTickets), tc.maxCollisions)
+			}
+		})
+	}
+}
+
+// seq returns the n values from start on
+func seq(start uint64, n int) []uint64 {
+	vals := make([]uint64, n)
+	for i := range vals {
+		vals[i] = start + uint64(i)
+	}
+	return vals
+}
+
+func TestAllTipsetsKeepsNullBlocksApart(t *testing.T) {
+	ct := NewChainTracker(nil)
+	genesis := ct.NewTipset([]*Block{testGen(t, ct, 1, 3)})
+	block := func(owner int, null bool) *Block {
+		blk := &Block{Nonce: ct.newNonce(), Owner: owner, Height: 1, Parents: genesis, Seed: uint64(10 - owner), Null: null}
+		if !null {
+			blk.WinCount = 1
+		}
+		return blk
+	}
+	// a miner's null block shares its parents and height with the others'
+	// live blocks, but can't be mined on alongside them
+	live0, null1, live2, null3 := block(0, false), block(1, true), block(2, false), block(3, true)
+
+	var got []string
+	for _, ts := range ct.allTipsets([]*Block{live0, null1, live2, null3}) {
+		if err := ts.Validate(0); err != nil {
+			t.Error(err)
+		}
+		got = append(got, ts.Name)
+	}
+	want := []string{stringifyBlocks([]*Block{live2, live0}), stringifyBlocks([]*Block{null1}), stringifyBlocks([]*Block{null3})}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("tipsets %v, want %v", got, want)
+	}
+}
+
+func TestAllNullRounds(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		honest float64
+		lbp    int
+	}{
+		{"rational", 0, 1},
+		{"honest", 1, 1},
+		{"mixed", 0.5, 1},
+		{"mixed lookback", 0.5, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(t, 6, 12, tc.lbp)
+			cfg.honestFrac = tc.honest
+			// nobody wins heights 3 to 5, then miners 0 and 1 win
+			script, err := parseScriptedElection("3:,4:,5:,6:0+1", cfg.totalMiners)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.oracle = script
+			ct, err := runSim(cfg, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for round := 2; round <= 4; round++ {
+				if n := ct.blocksPerRound[round]; n != 0 {
+					t.Errorf("%d blocks mined in round %d, want none", n, round)
+				}
+			}
+			for h := 3; h <= 5; h++ {
+				if blocks, ok := ct.liveBlocksByHeight[h]; ok {
+					t.Errorf("%d live blocks at height %d, want none", len(blocks), h)
+				}
+			}
+			winners := ct.liveBlocksByHeight[6]
+			if len(winners) < 2 {
+				t.Fatalf("%d live blocks at height 6, want the scripted winners", len(winners))
+			}
+			for _, blk := range winners {
+				// mined atop a chain of the miner's own null blocks
+				ts := blk.Parents
+				for h := 5; h >= 3; h-- {
+					if ts.getHeight() != h || !ts.Blocks[0].Null || ts.Blocks[0].Owner != blk.Owner {
+						t.Fatalf("block %d has ancestor %s at height %d, want m%d's null block at height %d", blk.Nonce, ts.Name, ts.getHeight(), blk.Owner, h)
+					}
+					ts = ts.getParents()
+				}
+			}
+		})
+	}
+}
+
+func TestStallsCountNullElections(t *testing.T) {
+	cfg := testConfig(t, 4, 9, 1)
+	mix, err := parseStrategyMix("rational:3,reorg:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.mix = mix
+	cfg.reorgDepth = 3
+	// the reorg attacker, miner 3, withholds what it wins at height 2, and
+	// nobody wins heights 3 and 5
+	script, err := parseScriptedElection("1:0,2:3,3:,4:1,5:,6:0,7:2,8:1", cfg.totalMiners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.oracle = script
+	ct, err := runSim(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := ct.blocksPerRound[1]; n != 0 {
+		t.Fatalf("%d blocks published in round 1, want the attacker's withheld", n)
+	}
+	if ct.stalls != 2 {
+		t.Errorf("%d stalls, want 2", ct.stalls)
+	}
+}
+
+func TestReorgAttackersPoolPower(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		adversary float64
+		succeeds  bool
+	}{
+		{"majority", 0.6, true},
+		{"minority", 0.1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(t, 10, 200, 1)
+			cfg.attack = "reorg"
+			cfg.adversaryFrac = tc.adversary
+			cfg.reorgDepth = 2
+			ct, err := runSim(cfg, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the attackers, each with a tenth of the power, share one
+			// private chain, so an attack only starts once the last was
+			// published
+			attempts, durations := reorgAttackOutcomes(ct)
+			if attempts == 0 {
+				t.Fatal("no reorg attacks")
+			}
+			for i, a := range ct.reorgAttacks[:attempts-1] {
+				if a.Release < 0 {
+					t.Fatalf("attack %d started while attack %d was withheld", i+1, i)
+				}
+			}
+			if succeeded := len(durations) > 0; succeeded != tc.succeeds {
+				t.Errorf("%d of %d attacks by %v of the power rewrote the chain", len(durations), attempts, tc.adversary)
+			}
+		})
+	}
+}
+
+func TestLookbackCacheHoldsOneHeight(t *testing.T) {
+	cfg := testConfig(t, 10, 200, 20)
+	ct, err := runSim(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ct.lookbacks) == 0 {
+		t.Fatal("no lookbacks cached")
+	}
+	// the last round mined atop tipsets at the last height, so only their
+	// lookbacks are left
+	for key, ts := range ct.lookbacks {
+		if want := ct.maxHeight + 1 - key.lbp; ts.getHeight() != want {
+			t.Errorf("lookback %d from %s cached as %s at height %d, want height %d", key.lbp, key.name, ts.Name, ts.getHeight(), want)
+		}
+	}
+}
+
+func TestLookbackPastGenesis(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		lbp, rounds int
+	}{
+		{"single lookback", 1, 5},
+		{"within the chain", 3, 10},
+		{"as long as the run", 10, 10},
+		{"longer than the run", 20, 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ct := NewChainTracker(nil)
+			gen := testGen(t, ct, tc.lbp, 4)
+			length := 0
+			for ts := ct.NewTipset([]*Block{gen}); ts != nil; ts = ts.getParents() {
+				length++
+			}
+			if length != tc.lbp {
+				t.Errorf("genesis chain of %d tipsets, want lbp %d", length, tc.lbp)
+			}
+
+			// walking back from genesis itself stops at its first ancestor
+			// rather than following a nil parent
+			first := ct.NewTipset([]*Block{gen})
+			for ts := first; ts.getParents() != nil; ts = ts.getParents() {
+				first = ts.getParents()
+			}
+			if got := lookbackTipset(ct.NewTipset([]*Block{gen}), tc.lbp+5); got.Name != first.Name {
+				t.Errorf("lookback %d from genesis reached %s, want its first ancestor %s", tc.lbp+5, got.Name, first.Name)
+			}
+
+			cfg := testConfig(t, 4, tc.rounds, tc.lbp)
+			sim, err := runSim(cfg, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the last round's blocks are mined but not delivered
+			if sim.maxHeight != tc.rounds-1 {
+				t.Errorf("chain reached height %d, want %d", sim.maxHeight, tc.rounds-1)
+			}
+			for _, blk := range sim.allBlocks {
+				if blk.Height > 0 && blk.Parents == nil {
+					t.Errorf("block %d at height %d has no parents", blk.Nonce, blk.Height)
+				}
+			}
+		})
+	}
+}
+
+func TestMinerTicketsIndependent(t *testing.T) {
+	const draws = 5000
+	// sample correlation of two miners' streams, about 1/sqrt(len(a)) apart
+	// from 0 when independent
+	correlation := func(a, b []float64) float64 {
+		var ma, mb float64
+		for i := range a {
+			ma += a[i] / float64(len(a))
+			mb += b[i] / float64(len(a))
+		}
+		var cov, va, vb float64
+		for i := range a {
+			cov += (a[i] - ma) * (b[i] - mb)
+			va += (a[i] - ma) * (a[i] - ma)
+			vb += (b[i] - mb) * (b[i] - mb)
+		}
+		return cov / math.Sqrt(va*vb)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		stream func(id int) []float64
+	}{
+		{"rngs", func(id int) []float64 {
+			rng := minerRand(1, id)
+			vals := make([]float64, draws)
+			for i := range vals {
+				vals[i] = rng.Float64()
+			}
+			return vals
+		}},
+		// adjacent miners drawing on the same lookback tickets
+		{"tickets", func(id int) []float64 {
+			m := NewRationalMiner(id, 0, 10, bigOlNum, nil)
+			vals := make([]float64, draws)
+			for i := range vals {
+				vals[i] = float64(m.generateTicket(uint64(i)))
+			}
+			return vals
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			streams := make([][]float64, 10)
+			for id := range streams {
+				streams[id] = tc.stream(id)
+			}
+			for a := range streams {
+				for b := a + 1; b < len(streams); b++ {
+					// seeds of minTicket + ID shift adjacent miners' streams
+					// by their difference in IDs, so look a few draws apart
+					for lag := 0; lag < len(streams); lag++ {
+						n := draws - lag
+						// five standard errors
+						if r := correlation(streams[a][lag:], streams[b][:n]); math.Abs(r) > 5/math.Sqrt(float64(n)) {
+							t.Errorf("miners %d and %d correlate %f %d draws apart", a, b, r, lag)
+						}
+					}
+				}
+			}
+		})
+	}
+
+	a, b := minerRand(7, 3), minerRand(7, 3)
+	for i := 0; i < 100; i++ {
+		if x, y := a.Int63(), b.Int63(); x != y {
+			t.Fatalf("draw %d of miner 3 with seed 7 was %d then %d", i, x, y)
+		}
+	}
+}
+
+// fuzzBlocks decodes data into a set of blocks of mixed heights, parents and
+// null blocks, three bytes a block, sometimes repeating an earlier block.
+// Blocks are mined on genesis' first ancestor, which has no parents, or one
+// of a few other tipsets of the chain.
+func fuzzBlocks(ct *ChainTracker, data []byte) []*Block {
+	parents := []*Tipset{nil}
+	for i := 1; i <= 3; i++ {
+		parents = append(parents, ct.NewTipset([]*Block{{Nonce: 100 + i, Owner: -1, Seed: uint64(i)}}))
+	}
+	var blocks []*Block
+	for i := 0; i+3 <= len(data); i += 3 {
+		shape, parent, ticket := data[i], data[i+1], data[i+2]
+		if len(blocks) > 0 && parent&0x30 == 0x30 {
+			blocks = append(blocks, blocks[int(ticket)%len(blocks)])
+			continue
+		}
+		blk := &Block{
+			Nonce:    len(blocks),
+			Owner:    int(shape % 4),
+			Height:   1 + int(shape>>2)%2,
+			Parents:  parents[parent%4],
+			Seed:     uint64(ticket % 16),
+			WinCount: 1 + int(shape>>3)%2,
+		}
+		if shape>>4%4 == 0 {
+			blk.Null = true
+			blk.WinCount = 0
+		}
+		blocks = append(blocks, blk)
+	}
+	return blocks
+}
+
+// addFuzzSeeds seeds f with random block sets, each with a tipset cap
+func addFuzzSeeds(f *testing.F) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		data := make([]byte, 3*rng.Intn(9))
+		rng.Read(data)
+		f.Add(data, uint8(rng.Intn(4)))
+	}
+}
+
+// referenceTipsets groups blocks into tipsets keyed by blockSetKey, the way
+// a map based grouping dedupes them: the distinct blocks of each parents and
+// height, capped by the chain's capTipset, and each null block alone.
+func referenceTipsets(ct *ChainTracker, blocks []*Block) map[string][]*Block {
+	groups := make(map[tipsetKey]map[int]*Block)
+	tipsets := make(map[string][]*Block)
+	for _, blk := range blocks {
+		if blk.Null {
+			tipsets[blockSetKey([]*Block{blk})] = []*Block{blk}
+			continue
+		}
+		key := tipsetKey{parents: parentName(blk), height: blk.Height}
+		if groups[key] == nil {
+			groups[key] = make(map[int]*Block)
+		}
+		groups[key][blk.Nonce] = blk
+	}
+	for _, group := range groups {
+		var ts []*Block
+		for _, blk := range group {
+			ts = append(ts, blk)
+		}
+		ts = ct.capTipset(ts)
+		tipsets[blockSetKey(ts)] = ts
+	}
+	return tipsets
+}
+
+// blockSetKey identifies a set of blocks by their sorted nonces, as tipset
+// names don't when blocks share a ticket
+func blockSetKey(blocks []*Block) string {
+	nonces := make([]int, len(blocks))
+	for i, blk := range blocks {
+		nonces[i] = blk.Nonce
+	}
+	sort.Ints(nonces)
+	return fmt.Sprint(nonces)
+}
+
+func TestAllTipsetsMatchesMapGrouping(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, tc := range []struct {
+		name string
+		// blocks as decoded by fuzzBlocks, and the tipset cap
+		data          []byte
+		maxTipsetSize int
+	}{
+		{"no blocks", nil, 0},
+		{"one block", []byte{0x10, 1, 5}, 0},
+		{"siblings", []byte{0x10, 1, 5, 0x11, 1, 3, 0x12, 1, 9}, 0},
+		// the first block given again, then twice more
+		{"repeated block", []byte{0x10, 1, 5, 0x11, 1, 3, 0, 0x31, 0, 0, 0x31, 2}, 0},
+		{"null among siblings", []byte{0x10, 1, 5, 0x01, 1, 3, 0x12, 1, 9}, 0},
+		{"capped siblings", []byte{0x10, 1, 5, 0x11, 1, 3, 0x12, 1, 9, 0x13, 1, 1}, 2},
+		{"mixed parents and heights", []byte{0x10, 1, 5, 0x14, 1, 3, 0x11, 2, 9, 0x15, 2, 1, 0x12, 0, 4}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			checkAllTipsetsMatchesMapGrouping(t, tc.data, tc.maxTipsetSize)
+		})
+	}
+	for i := 0; i < 1000; i++ {
+		data := make([]byte, 3*rng.Intn(9))
+		rng.Read(data)
+		checkAllTipsetsMatchesMapGrouping(t, data, rng.Intn(4))
+	}
+}
+
+// checkAllTipsetsMatchesMapGrouping checks that allTipsets builds each of
+// the tipsets referenceTipsets does from the blocks data decodes to, once
+func checkAllTipsetsMatchesMapGrouping(t *testing.T, data []byte, maxTipsetSize int) {
+	t.Helper()
+	ct := NewChainTracker(nil)
+	ct.maxTipsetSize = maxTipsetSize
+	blocks := fuzzBlocks(ct, data)
+	want := referenceTipsets(ct, blocks)
+	built := make(map[string]bool)
+	for _, ts := range ct.allTipsets(append([]*Block(nil), blocks...)) {
+		key := blockSetKey(ts.Blocks)
+		if built[key] {
+			t.Errorf("blocks %v: tipset %s built twice", data, ts.Name)
+		}
+		if _, ok := want[key]; !ok {
+			t.Errorf("blocks %v: unexpected tipset %s", data, ts.Name)
+		}
+		built[key] = true
+	}
+	if len(built) != len(want) {
+		t.Errorf("blocks %v: %d tipsets built, want %d", data, len(built), len(want))
+	}
+}
+
+func FuzzAllTipsets(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte, maxTipsetSize uint8) {
+		ct := NewChainTracker(nil)
+		ct.maxTipsetSize = int(maxTipsetSize % 4)
+		blocks := fuzzBlocks(ct, data)
+
+		// every block lands in exactly one valid tipset, unless the cap
+		// leaves it out
+		seen := make(map[*Block]int)
+		for _, ts := range ct.allTipsets(append([]*Block(nil), blocks...)) {
+			if err := ts.Validate(ct.maxTipsetSize); err != nil {
+				t.Fatal(err)
+			}
+			for _, blk := range ts.Blocks {
+				seen[blk]++
+			}
+		}
+		for _, blk := range blocks {
+			if seen[blk] > 1 || (seen[blk] == 0 && ct.maxTipsetSize == 0) {
+				t.Fatalf("block %d is in %d tipsets", blk.Nonce, seen[blk])
+			}
+		}
+	})
+}
+
+func FuzzNewTipset(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte, maxTipsetSize uint8) {
+		ct := NewChainTracker(nil)
+		ct.maxTipsetSize = int(maxTipsetSize % 4)
+		blocks := fuzzBlocks(ct, data)
+
+		// any set of blocks either makes a valid tipset or is rejected
+		ts, err := ct.checkedTipset(append([]*Block(nil), blocks...))
+		if err != nil {
+			return
+		}
+		if err := ts.Validate(ct.maxTipsetSize); err != nil {
+			t.Fatalf("checkedTipset built an invalid tipset: %s", err)
+		}
+		if len(ts.Blocks) != len(blocks) || ts.Name != stringifyBlocks(ts.Blocks) {
+			t.Errorf("tipset %s of %d blocks built from %d", ts.Name, len(ts.Blocks), len(blocks))
+		}
+	})
+}
+
+func TestNewTipsetRecordsStrictViolations(t *testing.T) {
+	ct := NewChainTracker(nil)
+	ct.strict = true
+	genesis := ct.NewTipset([]*Block{testGen(t, ct, 1, 2)})
+	a := &Block{Nonce: ct.newNonce(), Owner: 0, Height: 1, Parents: genesis, WinCount: 1}
+	b := &Block{Nonce: ct.newNonce(), Owner: 1, Height: 2, Parents: genesis, WinCount: 1}
+	ct.NewTipset([]*Block{a})
+	if ct.strictErr != nil {
+		t.Fatalf("valid tipset recorded %v", ct.strictErr)
+	}
+	ct.NewTipset([]*Block{a, b})
+	if ct.strictErr == nil || !strings.Contains(ct.strictErr.Error(), "mixes heights") {
+		t.Errorf("tipset mixing heights recorded %v", ct.strictErr)
+	}
+}
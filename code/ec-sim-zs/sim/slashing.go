@@ -0,0 +1,81 @@
+package sim
+
+import (
+	"sort"
+)
+
+// SlashingEvent records a miner equivocating: mining several non-null blocks
+// at the same height on different parents
+type SlashingEvent struct {
+	Miner  int
+	Height int
+	Nonces []int
+}
+
+// slashingDetector returns every slashable equivocation among the chain's
+// blocks, sorted by height then miner.  A miner only ever mines one block per
+// round, so none are expected from the built-in strategies unless rational
+// miners are given a -risk of equivocating.
+func slashingDetector(ct *ChainTracker) []SlashingEvent {
+	type slot struct {
+		miner, height int
+	}
+	bySlot := make(map[slot][]*Block)
+	for _, blk := range ct.allBlocks {
+		if blk.Null || blk.Owner == -1 {
+			continue
+		}
+		s := slot{miner: blk.Owner, height: blk.Height}
+		bySlot[s] = append(bySlot[s], blk)
+	}
+
+	var events []SlashingEvent
+	for s, blks := range bySlot {
+		if len(blks) < 2 {
+			continue
+		}
+		parents := make(map[string]bool)
+		for _, blk := range blks {
+			parents[blk.Parents.Name] = true
+		}
+		if len(parents) < 2 {
+			continue
+		}
+
+		nonces := make([]int, 0, len(blks))
+		for _, blk := range blks {
+			nonces = append(nonces, blk.Nonce)
+		}
+		sort.Ints(nonces)
+		events = append(events, SlashingEvent{Miner: s.miner, Height: s.height, Nonces: nonces})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Height != events[j].Height {
+			return events[i].Height < events[j].Height
+		}
+		return events[i].Miner < events[j].Miner
+	})
+	return events
+}
+
+// printSlashingTradeoff reports, for the miners that equivocated, the
+// penalties they paid against the block rewards they earned, averaged over
+// all trials.
+func printSlashingTradeoff(cts []*ChainTracker) {
+	var penalties, rewards float64
+	for _, ct := range cts {
+		slashed := make(map[int]bool)
+		for _, ev := range slashingDetector(ct) {
+			slashed[ev.Miner] = true
+			penalties += ct.slashPenalty
+		}
+		for nonce := range headAncestry(ct) {
+			if blk := ct.allBlocks[nonce]; slashed[blk.Owner] {
+				rewards += ct.blockReward
+			}
+		}
+	}
+	n := float64(len(cts))
+	reportf("equivocating miners' slashing penalties vs block rewards per trial: %f vs %f\n", penalties/n, rewards/n)
+}
@@ -0,0 +1,76 @@
+package sim
+
+import (
+	"math/rand"
+)
+
+// Miner is a mining strategy.  Mine outputs the block the miner publishes in
+// a round (nil if it has nothing to publish) given the chain tracker and the
+// forks made available by the previous round's blocks.
+// RationalMiner is the default implementation.
+type Miner interface {
+	Mine(ct *ChainTracker, atsforks [][]*Tipset) *Block
+	ID() int
+	Power() float64
+	Adversarial() bool
+	// Bootstrap has a miner joining the network mine atop head from now on,
+	// dropping whatever it was mining on before
+	Bootstrap(head *Tipset)
+}
+
+//**** Honest Miner
+
+// HonestMiner only ever mines atop the heaviest tipset it has seen
+// (ct.headFor), extending it with its own null blocks while it keeps losing.
+// It draws tickets exactly as a RationalMiner does but never keeps a set of
+// private forks.
+type HonestMiner struct {
+	*RationalMiner
+	Honest bool `json:"honest"`
+
+	// Base is the tipset the miner is currently mining on: either the head
+	// or a null block chain atop the head
+	Base *Tipset `json:"base,omitempty"`
+	// HeadName is the name of the head Base was built on
+	HeadName string `json:"headName,omitempty"`
+}
+
+func NewHonestMiner(id int, power float64, totalMiners int, ticketSpace uint64, rng *rand.Rand) *HonestMiner {
+	return &HonestMiner{
+		RationalMiner: NewRationalMiner(id, power, totalMiners, ticketSpace, rng),
+		Honest:        true,
+	}
+}
+
+// Mine outputs the block mined atop the current head, or nil if the miner
+// did not win this round.
+func (m *HonestMiner) Mine(ct *ChainTracker, atsforks [][]*Tipset) *Block {
+	head := ct.headFor(m.MinerID)
+	if m.Base == nil || head.Name != m.HeadName {
+		m.Base = head
+		m.HeadName = head.Name
+	}
+
+	blk := m.generateBlock(ct, m.Base)
+	if !blk.Null {
+		m.Base = nil
+		return blk
+	}
+
+	// keep track of the null block so a later winning block's history can be
+	// rebuilt, and keep mining atop it until the head changes
+	ct.allBlocks[blk.Nonce] = blk
+	m.Base = ct.NewTipset([]*Block{blk})
+	ct.logf(logBlocks, "honest miner %d. null block at height %d\n", m.MinerID, blk.Height)
+	return nil
+}
+
+// Bootstrap has the miner build on head, which may be the network's head
+// extended with the miner's own null blocks
+func (m *HonestMiner) Bootstrap(head *Tipset) {
+	m.Base = head
+	m.HeadName = head.Name
+	if head.Blocks[0].Null {
+		m.HeadName = head.Blocks[0].liveParents().Name
+	}
+}
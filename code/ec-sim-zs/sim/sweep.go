@@ -0,0 +1,165 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SweepConfig describes a parameter sweep: every combination of miner count
+// and lookback is simulated for the given number of rounds and trials.  An
+// optional mix of strategies applies to every miner count.
+type SweepConfig struct {
+	Miners []int        `json:"miners"`
+	LBPs   []int        `json:"lbps"`
+	Rounds int          `json:"rounds"`
+	Trials int          `json:"trials"`
+	Mix    StrategyMix  `json:"mix"`
+	Output OutputConfig `json:"output"`
+}
+
+// OutputConfig says what a sweep writes out for each combination
+type OutputConfig struct {
+	// folder outputs are written to
+	Dir string `json:"dir"`
+	// write a CSV of per-trial statistics
+	Stats bool `json:"stats"`
+	// write every trial's chain as JSON
+	JSON bool `json:"json"`
+	// write every trial's canonical chain as a JSON list of tipsets
+	Canonical bool `json:"canonical"`
+	// write a grid of a metric over every combination
+	Heatmap *HeatmapConfig `json:"heatmap"`
+}
+
+// defaultSweepConfig returns the sweep run for fields a config leaves out
+func defaultSweepConfig() *SweepConfig {
+	return &SweepConfig{
+		Miners: []int{10, 100},
+		LBPs:   []int{1, 50, 100, 150},
+		Rounds: 300,
+		Trials: 20,
+		Output: OutputConfig{Dir: "."},
+	}
+}
+
+// loadSweepConfig reads a sweep config from a JSON file
+func loadSweepConfig(path string) (*SweepConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := defaultSweepConfig()
+	if err := json.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+
+	if len(sc.Miners) == 0 || len(sc.LBPs) == 0 {
+		return nil, fmt.Errorf("sweep needs at least one miner count and lbp")
+	}
+	for _, m := range sc.Miners {
+		if m <= 0 {
+			return nil, fmt.Errorf("invalid miner count %d", m)
+		}
+	}
+	for _, lbp := range sc.LBPs {
+		if lbp <= 0 {
+			return nil, fmt.Errorf("invalid lbp %d", lbp)
+		}
+	}
+	if sc.Rounds <= 0 || sc.Trials <= 0 {
+		return nil, fmt.Errorf("rounds and trials must be positive")
+	}
+	if sc.Mix != nil {
+		if err := sc.Mix.validate(); err != nil {
+			return nil, fmt.Errorf("mix: %s", err)
+		}
+	}
+	if sc.Output.Heatmap != nil {
+		if err := sc.Output.Heatmap.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// runSweep runs and analyzes every combination of the sweep, writing events
+// to events if set.  base provides the parameters the sweep doesn't vary,
+// and is checked against each miner count before its combinations run, so
+// that e.g. its powers, script and churn must fit every count.
+func runSweep(sc *SweepConfig, base Config, events *eventWriter, seedFor func(n int) int64, quiet bool, ap *analysisParams) error {
+	var hm *heatmap
+	var metric func(ct *ChainTracker) float64
+	if hc := sc.Output.Heatmap; hc != nil {
+		hm = newHeatmap(hc, sc)
+		metric, _ = heatmapMetric(hc.Metric, ap)
+	}
+
+	for _, miners := range sc.Miners {
+		c := base
+		c.Miners = miners
+		c.Rounds = sc.Rounds
+		c.Trials = sc.Trials
+		// the sweep's lbps and mix replace the flags'
+		c.LBP, c.LBPSchedule = sc.LBPs[0], ""
+		if sc.Mix != nil {
+			c.Mix = ""
+		}
+		shared, err := c.build()
+		if err != nil {
+			return fmt.Errorf("%d miners: %s", miners, err)
+		}
+		shared.events = events
+		if sc.Mix != nil {
+			shared.mix = sc.Mix
+			if err := shared.checkRoles(); err != nil {
+				return fmt.Errorf("%d miners: %s", miners, err)
+			}
+		}
+
+		for _, lbp := range sc.LBPs {
+			cfg := *shared
+			cfg.lbps = constantLBP(lbp)
+
+			cts, err := runTrials(&cfg, sc.Trials, seedFor, quiet)
+			if err != nil {
+				return fmt.Errorf("%d miners, lbp %d: %s", miners, lbp, err)
+			}
+			name := fmt.Sprintf("rds=%d-lbp=%d-mins=%d", sc.Rounds, lbp, miners)
+			reportf("=== %s\n", name)
+			analyzeSim(cts, ap)
+
+			if hm != nil {
+				values := make([]float64, len(cts))
+				for i, ct := range cts {
+					values[i] = metric(ct)
+				}
+				mean, _ := meanAndVariance(values)
+				hm.set(miners, lbp, mean)
+			}
+			if sc.Output.Stats {
+				writeStats(cts, filepath.Join(sc.Output.Dir, name+".csv"), ap.warmup)
+			}
+			if sc.Output.JSON {
+				for i, ct := range cts {
+					writeChain(ct, fmt.Sprintf("%s-%d", name, i+1), sc.Output.Dir)
+				}
+			}
+			if sc.Output.Canonical {
+				for i, ct := range cts {
+					writeCanonicalChain(ct, filepath.Join(sc.Output.Dir, fmt.Sprintf("%s-%d.canonical.json", name, i+1)))
+				}
+			}
+		}
+	}
+
+	if hm != nil {
+		name := fmt.Sprintf("rds=%d-heatmap-%s", sc.Rounds, hm.metric)
+		hm.writeCSV(filepath.Join(sc.Output.Dir, name+".csv"))
+		if sc.Output.Heatmap.SVG {
+			hm.writeSVG(filepath.Join(sc.Output.Dir, name+".svg"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunSweepChecksEachMinerCount(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(c *Config)
+		// substring of the error, none if empty
+		want string
+	}{
+		{"fits every count", func(c *Config) { c.Script, c.Churn = "1:0+3", "miner3@leave2" }, ""},
+		{"powers", func(c *Config) { c.Powers = "0.25,0.25,0.25,0.25" }, "6 miners: invalid -powers"},
+		{"hash rates", func(c *Config) { c.Powers, c.HashRate = "1,2,3,4,5,6", true }, "4 miners: invalid -powers"},
+		{"script", func(c *Config) { c.Script = "1:5" }, "4 miners: invalid -script"},
+		{"churn", func(c *Config) { c.Churn = "miner4@join2" }, "4 miners: invalid -churn"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			base := DefaultConfig()
+			seed := int64(1)
+			base.Seed = &seed
+			tc.modify(&base)
+			sc := &SweepConfig{Miners: []int{4, 6}, LBPs: []int{1, 2}, Rounds: 5, Trials: 1, Output: OutputConfig{Dir: t.TempDir()}}
+			ap := &analysisParams{confidence: 6, qualityWindow: 10, giniWindow: 10}
+			err := runSweep(sc, base, nil, func(n int) int64 { return int64(n) }, true, ap)
+			if tc.want == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("runSweep returned %v, want an error with %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package sim
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// TieBreaker reports whether tipset a should be preferred over tipset b when
+// both have the same weight.
+type TieBreaker func(a, b *Tipset) bool
+
+// tieBreakerFactory builds a tiebreaker for a chain mined by miners, for
+// tiebreakers that look at the miners' powers
+type tieBreakerFactory func(miners []Miner) TieBreaker
+
+// fixedTieBreaker returns the factory of a tiebreaker that ignores the miners
+func fixedTieBreaker(tb TieBreaker) tieBreakerFactory {
+	return func([]Miner) TieBreaker { return tb }
+}
+
+// minTicketTieBreaker prefers the tipset with the smallest ticket.  This is
+// the default fork choice tiebreaker.
+func minTicketTieBreaker(a, b *Tipset) bool {
+	return a.MinTicket < b.MinTicket
+}
+
+// cardinalityTieBreaker prefers the tipset with the most blocks, falling back
+// to the smallest ticket.
+func cardinalityTieBreaker(a, b *Tipset) bool {
+	if len(a.Blocks) != len(b.Blocks) {
+		return len(a.Blocks) > len(b.Blocks)
+	}
+	return minTicketTieBreaker(a, b)
+}
+
+// distinctMinersTieBreaker prefers the tipset mined by the most distinct
+// miners, falling back to the smallest ticket.
+func distinctMinersTieBreaker(a, b *Tipset) bool {
+	da, db := distinctOwners(a), distinctOwners(b)
+	if da != db {
+		return da > db
+	}
+	return minTicketTieBreaker(a, b)
+}
+
+// nameTieBreaker prefers the tipset with the lexicographically smallest name.
+func nameTieBreaker(a, b *Tipset) bool {
+	return a.Name < b.Name
+}
+
+// powerTieBreaker returns a tiebreaker preferring the tipset whose distinct
+// miners hold the most power, falling back to the smallest ticket.  Powers
+// are read when tipsets tie, so miners joining and leaving count.
+func powerTieBreaker(miners []Miner) TieBreaker {
+	return func(a, b *Tipset) bool {
+		pa, pb := ownersPower(miners, a), ownersPower(miners, b)
+		if pa != pb {
+			return pa > pb
+		}
+		return minTicketTieBreaker(a, b)
+	}
+}
+
+// powerCoinTieBreaker returns a tiebreaker flipping a coin weighted by the
+// power of each tipset's distinct miners, so a tipset with twice the power
+// wins twice as often.  The coin is a hash of the two names, so every miner
+// flipping it for the same pair of tipsets gets the same outcome, and runs
+// stay reproducible.  Tipsets without power fall back to the smallest ticket.
+func powerCoinTieBreaker(miners []Miner) TieBreaker {
+	return func(a, b *Tipset) bool {
+		first, second := a, b
+		if b.Name < a.Name {
+			first, second = b, a
+		}
+		pf, ps := ownersPower(miners, first), ownersPower(miners, second)
+		if pf+ps == 0 {
+			return minTicketTieBreaker(a, b)
+		}
+		h := fnv.New64a()
+		h.Write([]byte(first.Name + "/" + second.Name))
+		u := float64(h.Sum64()) / math.Exp2(64)
+		firstWins := u < pf/(pf+ps)
+		return firstWins == (a == first)
+	}
+}
+
+// ownersPower returns the total power of the distinct miners with blocks in
+// ts; genesis and its ancestors have none
+func ownersPower(miners []Miner, ts *Tipset) float64 {
+	var power float64
+	seen := make(map[int]bool, len(ts.Blocks))
+	for _, blk := range ts.Blocks {
+		if blk.Owner < 0 || blk.Owner >= len(miners) || seen[blk.Owner] {
+			continue
+		}
+		seen[blk.Owner] = true
+		power += miners[blk.Owner].Power()
+	}
+	return power
+}
+
+// distinctOwners returns the number of distinct miners with blocks in ts
+func distinctOwners(ts *Tipset) int {
+	owners := make(map[int]bool, len(ts.Blocks))
+	for _, blk := range ts.Blocks {
+		owners[blk.Owner] = true
+	}
+	return len(owners)
+}
+
+// parseTieBreaker returns the factory of the built-in tiebreaker with the
+// given name
+func parseTieBreaker(name string) (tieBreakerFactory, error) {
+	switch name {
+	case "", "minTicket":
+		return fixedTieBreaker(minTicketTieBreaker), nil
+	case "cardinality":
+		return fixedTieBreaker(cardinalityTieBreaker), nil
+	case "distinctMiners":
+		return fixedTieBreaker(distinctMinersTieBreaker), nil
+	case "name":
+		return fixedTieBreaker(nameTieBreaker), nil
+	case "power":
+		return powerTieBreaker, nil
+	case "powerCoin":
+		return powerCoinTieBreaker, nil
+	}
+	return nil, fmt.Errorf("unknown tiebreaker %q: must be minTicket, cardinality, distinctMiners, name, power or powerCoin", name)
+}
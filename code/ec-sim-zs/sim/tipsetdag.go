@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// drawTipsetDAG outputs a dot graph of the chain like drawChain, but boxing
+// the blocks at each height that share the same parents into a cluster: the
+// largest tipset they can form.  Edges point from each block to its live
+// parents.  As in drawChain, blocks in the head's ancestry are red, as are the
+// clusters holding them.  Blocks left out of a tipset by -maxTipsetSize are
+// drawn outside its cluster.
+func drawTipsetDAG(ct *ChainTracker, path string) {
+	reportf("Drawing Tipset DAG %s\n", path)
+
+	fil, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	defer fil.Close()
+
+	fmt.Fprintln(fil, "digraph G {")
+	fmt.Fprintln(fil, "\tnode [shape=box];")
+	for cur := ct.maxHeight; cur >= ct.prunedBelow; cur-- {
+		blocks := ct.liveBlocksByHeight[cur]
+
+		// group the height's blocks by parents
+		var names []string
+		groups := make(map[string][]*Block)
+		for _, block := range blocks {
+			name := ""
+			if block.Parents != nil {
+				name = block.Parents.Name
+			}
+			if _, ok := groups[name]; !ok {
+				names = append(names, name)
+			}
+			groups[name] = append(groups[name], block)
+		}
+		sort.Strings(names)
+
+		for i, name := range names {
+			tipset := ct.NewTipset(ct.capTipset(groups[name]))
+			fmt.Fprintf(fil, "\tsubgraph cluster_%d_%d {\n", cur, i)
+			fmt.Fprintf(fil, "\t\tlabel=\"%s\\nheight %d, weight %d\";\n", tipset.Name, cur, tipset.Weight)
+			for _, block := range tipset.Blocks {
+				if block.InHead {
+					fmt.Fprintln(fil, "\t\tcolor=\"red\";")
+					break
+				}
+			}
+			for _, block := range tipset.Blocks {
+				if block.InHead {
+					fmt.Fprintf(fil, "\t\t\"b%d (m%d)\" [color=\"red\", style=\"bold\"];\n", block.Nonce, block.Owner)
+				} else {
+					fmt.Fprintf(fil, "\t\t\"b%d (m%d)\";\n", block.Nonce, block.Owner)
+				}
+			}
+			fmt.Fprintln(fil, "\t}")
+			for _, block := range groups[name][len(tipset.Blocks):] {
+				fmt.Fprintf(fil, "\t\"b%d (m%d)\";\n", block.Nonce, block.Owner)
+			}
+		}
+
+		// link to parents
+		for _, l := range ct.parentLinks(blocks) {
+			fmt.Fprintf(fil, "\t\"b%d (m%d)\" -> \"b%d (m%d)\";\n", l.child.Nonce, l.child.Owner, l.parent.Nonce, l.parent.Owner)
+		}
+	}
+	fmt.Fprintln(fil, "}")
+}
@@ -0,0 +1,326 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Topology places miners on a network graph whose links each take a number
+// of rounds to cross.  Blocks mined in round r reach every miner in round
+// r+1 without a topology; under one, a block mined by miner i reaches miner
+// j Delay(i, j) rounds later still, its distance in links times the delay of
+// a link.
+type Topology struct {
+	Name string
+	// delays[i][j] is the number of extra rounds a block mined by miner i
+	// takes to reach miner j
+	delays [][]int
+	// longest of the delays
+	longest int
+}
+
+// topologyFactory builds the topology of a trial among totalMiners miners,
+// drawing any randomness it needs from rng
+type topologyFactory func(totalMiners int, rng *rand.Rand) *Topology
+
+// RingTopology links each miner to the next, and the last to the first
+func RingTopology(totalMiners, linkDelay int) *Topology {
+	links := make([][]int, totalMiners)
+	for i := range links {
+		if totalMiners > 1 {
+			links[i] = append(links[i], (i+1)%totalMiners, (i+totalMiners-1)%totalMiners)
+		}
+	}
+	return linkedTopology("ring", links, linkDelay)
+}
+
+// StarTopology links every miner to miner 0, at the center, so blocks of
+// the others take two links to reach each other
+func StarTopology(totalMiners, linkDelay int) *Topology {
+	links := make([][]int, totalMiners)
+	for i := 1; i < totalMiners; i++ {
+		links[0] = append(links[0], i)
+		links[i] = append(links[i], 0)
+	}
+	return linkedTopology("star", links, linkDelay)
+}
+
+// RandomTopology places miners uniformly at random in the unit square and
+// links those less than p apart, a random geometric graph.  Groups of miners
+// left apart are joined through their closest pair of miners, so that every
+// block reaches every miner.
+func RandomTopology(totalMiners int, p float64, linkDelay int, rng *rand.Rand) *Topology {
+	xs, ys := make([]float64, totalMiners), make([]float64, totalMiners)
+	for i := range xs {
+		xs[i], ys[i] = rng.Float64(), rng.Float64()
+	}
+	dist := func(i, j int) float64 { return math.Hypot(xs[i]-xs[j], ys[i]-ys[j]) }
+
+	links := make([][]int, totalMiners)
+	link := func(i, j int) {
+		links[i] = append(links[i], j)
+		links[j] = append(links[j], i)
+	}
+	for i := range links {
+		for j := i + 1; j < totalMiners; j++ {
+			if dist(i, j) < p {
+				link(i, j)
+			}
+		}
+	}
+
+	for {
+		component := components(links)
+		best, bi, bj := math.Inf(1), -1, -1
+		for i := range links {
+			for j := i + 1; j < totalMiners; j++ {
+				if component[i] != component[j] && dist(i, j) < best {
+					best, bi, bj = dist(i, j), i, j
+				}
+			}
+		}
+		if bi < 0 {
+			break
+		}
+		link(bi, bj)
+	}
+	return linkedTopology(fmt.Sprintf("random:%g", p), links, linkDelay)
+}
+
+// components labels each miner with the lowest miner it is connected to
+func components(links [][]int) []int {
+	component := make([]int, len(links))
+	for i := range component {
+		component[i] = -1
+	}
+	for i := range links {
+		if component[i] >= 0 {
+			continue
+		}
+		component[i] = i
+		queue := []int{i}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, next := range links[cur] {
+				if component[next] < 0 {
+					component[next] = i
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+	return component
+}
+
+// linkedTopology builds the delay matrix of the graph given by each miner's
+// links: the number of links on the shortest path between two miners times
+// linkDelay.  Every miner must be reachable from every other.
+func linkedTopology(name string, links [][]int, linkDelay int) *Topology {
+	t := &Topology{Name: name, delays: make([][]int, len(links))}
+	for from := range links {
+		hops := make([]int, len(links))
+		for i := range hops {
+			hops[i] = -1
+		}
+		hops[from] = 0
+		queue := []int{from}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, next := range links[cur] {
+				if hops[next] < 0 {
+					hops[next] = hops[cur] + 1
+					queue = append(queue, next)
+				}
+			}
+		}
+		t.delays[from] = make([]int, len(links))
+		for to, h := range hops {
+			if h < 0 {
+				panic(fmt.Sprintf("Check your assumptions: miner %d can't reach miner %d in the %s topology", from, to, name))
+			}
+			t.delays[from][to] = h * linkDelay
+			if t.delays[from][to] > t.longest {
+				t.longest = t.delays[from][to]
+			}
+		}
+	}
+	return t
+}
+
+// Delay returns the number of extra rounds a block mined by miner from takes
+// to reach miner to.  Genesis, mined by no miner, reaches everyone at once.
+func (t *Topology) Delay(from, to int) int {
+	if from < 0 {
+		return 0
+	}
+	return t.delays[from][to]
+}
+
+// maxDelay returns the longest delay between any two miners
+func (t *Topology) maxDelay() int {
+	return t.longest
+}
+
+// buildTopology builds the topology of a trial among totalMiners miners
+// seeded with seed, or returns nil if there is none.  Random topologies are
+// drawn as if by miner -2.
+func (cfg *simConfig) buildTopology(totalMiners int, seed int64) *Topology {
+	if cfg.topology == nil {
+		return nil
+	}
+	return cfg.topology(totalMiners, minerRand(seed, -2))
+}
+
+// parseTopology parses the -topology flag: ring, star or random:P, each
+// link taking linkDelay rounds to cross
+func parseTopology(spec string, linkDelay int) (topologyFactory, error) {
+	if linkDelay < 0 {
+		return nil, fmt.Errorf("link delay %d must not be negative", linkDelay)
+	}
+	switch {
+	case spec == "ring":
+		return func(n int, _ *rand.Rand) *Topology { return RingTopology(n, linkDelay) }, nil
+	case spec == "star":
+		return func(n int, _ *rand.Rand) *Topology { return StarTopology(n, linkDelay) }, nil
+	case strings.HasPrefix(spec, "random:"):
+		p, err := strconv.ParseFloat(strings.TrimPrefix(spec, "random:"), 64)
+		if err != nil || p <= 0 {
+			return nil, fmt.Errorf("invalid link distance %q: must be a positive number", strings.TrimPrefix(spec, "random:"))
+		}
+		return func(n int, rng *rand.Rand) *Topology { return RandomTopology(n, p, linkDelay, rng) }, nil
+	}
+	return nil, fmt.Errorf("unknown topology %q: must be ring, star or random:P", spec)
+}
+
+// deliveryQueue holds the blocks on their way to each miner under a
+// topology
+type deliveryQueue struct {
+	topology *Topology
+	// blocks reaching each miner, by round
+	inFlight map[int]map[int][]*Block
+	// blocks each miner has received, by height, for as long as blocks
+	// sharing their parents may still reach it
+	received map[int]map[int][]*Block
+}
+
+func newDeliveryQueue(t *Topology) *deliveryQueue {
+	return &deliveryQueue{
+		topology: t,
+		inFlight: make(map[int]map[int][]*Block),
+		received: make(map[int]map[int][]*Block),
+	}
+}
+
+// send puts blocks that would reach a miner in round, were there no
+// topology, on their way to it
+func (q *deliveryQueue) send(minerID, round int, blocks []*Block) {
+	if q.inFlight[minerID] == nil {
+		q.inFlight[minerID] = make(map[int][]*Block)
+	}
+	for _, blk := range blocks {
+		at := round + q.topology.Delay(blk.Owner, minerID)
+		q.inFlight[minerID][at] = append(q.inFlight[minerID][at], blk)
+	}
+}
+
+// receive returns the tipsets the blocks reaching a miner in round make,
+// each grouped with the blocks sharing its parents and height the miner
+// already had, along with the forks of each tipset that hold a block it
+// didn't have before.  Forks of blocks that arrive late are extended with
+// the miner's own null blocks up to round, as it couldn't mine on them
+// until now.
+func (q *deliveryQueue) receive(ct *ChainTracker, m Miner, round int) ([]*Tipset, [][]*Tipset) {
+	id := m.ID()
+	// blocks that reached the miner while it was away are dropped
+	var arrived []*Block
+	for at, blocks := range q.inFlight[id] {
+		if at == round {
+			arrived = blocks
+		}
+		if at <= round {
+			delete(q.inFlight[id], at)
+		}
+	}
+	if q.received[id] == nil {
+		q.received[id] = make(map[int][]*Block)
+	}
+	received := q.received[id]
+	// blocks delivered in a round are at its height, so nothing older than
+	// the longest delay can still arrive
+	for h := range received {
+		if h < round-q.topology.maxDelay() {
+			delete(received, h)
+		}
+	}
+
+	isNew := make(map[int]bool, len(arrived))
+	byHeight := make(map[int][]*Block)
+	for _, blk := range arrived {
+		isNew[blk.Nonce] = true
+		byHeight[blk.Height] = append(byHeight[blk.Height], blk)
+	}
+	heights := make([]int, 0, len(byHeight))
+	for h := range byHeight {
+		heights = append(heights, h)
+	}
+	sort.Ints(heights)
+
+	holdsNew := func(ts *Tipset) bool {
+		for _, blk := range ts.Blocks {
+			if isNew[blk.Nonce] {
+				return true
+			}
+		}
+		return false
+	}
+	var tipsets []*Tipset
+	var forks [][]*Tipset
+	for _, h := range heights {
+		blocks := append(append([]*Block(nil), received[h]...), byHeight[h]...)
+		received[h] = append(received[h], byHeight[h]...)
+		for _, ts := range ct.allTipsets(blocks) {
+			if !holdsNew(ts) {
+				continue
+			}
+			tipsets = append(tipsets, ts)
+			var tsForks []*Tipset
+			for _, f := range ct.forksFromTipset(ts) {
+				if !holdsNew(f) {
+					continue
+				}
+				if f.getHeight() < round {
+					f = rationalMiner(m).catchUp(ct, f, round)
+				}
+				tsForks = append(tsForks, f)
+			}
+			forks = append(forks, tsForks)
+		}
+	}
+	return tipsets, forks
+}
+
+// printTopologyStats reports how many heads miners saw at once under the
+// trials' topologies, over all trials
+func printTopologyStats(cts []*ChainTracker) {
+	var heads []float64
+	maxDelay := 0
+	for _, ct := range cts {
+		if ct.topology == nil {
+			return
+		}
+		if d := ct.topology.maxDelay(); d > maxDelay {
+			maxDelay = d
+		}
+		for _, n := range ct.distinctHeads {
+			heads = append(heads, float64(n))
+		}
+	}
+	reportf("topology %s, delays up to %d rounds\n", cts[0].topology.Name, maxDelay)
+	printSummary("distinct heads seen by miners per round", heads)
+}
@@ -0,0 +1,168 @@
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestTopologyDelays(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		topo *Topology
+		// delays from miner 0 to each miner, and from miner 1
+		from0, from1 []int
+	}{
+		{"ring", RingTopology(6, 2), []int{0, 2, 4, 6, 4, 2}, []int{2, 0, 2, 4, 6, 4}},
+		{"star", StarTopology(4, 3), []int{0, 3, 3, 3}, []int{3, 0, 6, 6}},
+		{"no link delay", RingTopology(5, 0), []int{0, 0, 0, 0, 0}, []int{0, 0, 0, 0, 0}},
+		{"single miner", RingTopology(1, 1), []int{0}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, rows := range [][]int{tc.from0, tc.from1} {
+				for j, want := range rows {
+					if got := tc.topo.Delay(i, j); got != want {
+						t.Errorf("delay from miner %d to %d is %d, want %d", i, j, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRandomTopology(t *testing.T) {
+	for _, p := range []float64{0.01, 0.2, 2} {
+		t.Run(fmt.Sprint("p=", p), func(t *testing.T) {
+			const miners = 30
+			topo := RandomTopology(miners, p, 1, rand.New(rand.NewSource(4)))
+			// the same draws lay out the same network
+			again := RandomTopology(miners, p, 1, rand.New(rand.NewSource(4)))
+			for i := 0; i < miners; i++ {
+				for j := 0; j < miners; j++ {
+					d := topo.Delay(i, j)
+					if (i == j) != (d == 0) {
+						t.Errorf("delay from miner %d to %d is %d", i, j, d)
+					}
+					if d != topo.Delay(j, i) || d != again.Delay(i, j) {
+						t.Errorf("delays between miners %d and %d differ: %d, %d and %d", i, j, d, topo.Delay(j, i), again.Delay(i, j))
+					}
+				}
+			}
+			// everyone is linked within reach, and no one when too far apart
+			// to link, other than to join the network up
+			if p > 1.5 && topo.maxDelay() != 1 {
+				t.Errorf("delays up to %d, want 1 with every miner linked", topo.maxDelay())
+			}
+			if p < 0.05 && topo.maxDelay() < 5 {
+				t.Errorf("delays up to %d, want a sparse network", topo.maxDelay())
+			}
+		})
+	}
+}
+
+func TestDeliveryQueue(t *testing.T) {
+	ct := NewChainTracker(nil)
+	gen := testGen(t, ct, 1, 4)
+	genesis := ct.NewTipset([]*Block{gen})
+	m := NewRationalMiner(2, 0.25, 4, bigOlNum, nil)
+	// a ring of 4: miner 2 is a link away from miners 1 and 3, two from 0
+	q := newDeliveryQueue(RingTopology(4, 1))
+
+	near := &Block{Nonce: ct.newNonce(), Owner: 1, Height: 1, Parents: genesis, Seed: 50, WinCount: 1}
+	far := &Block{Nonce: ct.newNonce(), Owner: 0, Height: 1, Parents: genesis, Seed: 10, WinCount: 1}
+	q.send(m.ID(), 1, []*Block{near, far})
+
+	for _, tc := range []struct {
+		round int
+		// tipsets the miner receives, and the heights of their forks
+		tipsets [][]*Block
+		heights string
+	}{
+		{1, nil, "[]"},
+		{2, [][]*Block{{near}}, "[[2]]"},
+		// the far block makes a tipset with the near one, and only the fork
+		// holding it is new
+		{3, [][]*Block{{far, near}}, "[[3]]"},
+		{4, nil, "[]"},
+	} {
+		t.Run(fmt.Sprint("round", tc.round), func(t *testing.T) {
+			tipsets, forks := q.receive(ct, m, tc.round)
+			var got, want []string
+			for _, ts := range tipsets {
+				got = append(got, ts.Name)
+			}
+			for _, blocks := range tc.tipsets {
+				want = append(want, stringifyBlocks(blocks))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("received %v, want %v", got, want)
+			}
+			var heights [][]int
+			for _, fs := range forks {
+				var hs []int
+				for _, f := range fs {
+					hs = append(hs, f.getHeight())
+					// forks of late blocks are extended with the miner's null
+					// blocks up to the round
+					for ts := f; ts.getHeight() > 1; ts = ts.getParents() {
+						if blk := ts.Blocks[0]; !blk.Null || blk.Owner != m.MinerID {
+							t.Errorf("fork %s extended with block %d of m%d, null %t", f.Name, blk.Nonce, blk.Owner, blk.Null)
+						}
+					}
+				}
+				heights = append(heights, hs)
+			}
+			if got := fmt.Sprint(heights); got != tc.heights {
+				t.Errorf("forks at heights %s, want %s", got, tc.heights)
+			}
+		})
+	}
+}
+
+func TestZeroLinkDelayMatchesNoTopology(t *testing.T) {
+	for _, honest := range []float64{0, 0.5, 1} {
+		t.Run(fmt.Sprint("honest=", honest), func(t *testing.T) {
+			cfg := testConfig(t, 8, 40, 3)
+			cfg.honestFrac = honest
+			want, err := runSim(cfg, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.topology, err = parseTopology("random:0.3", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := runSim(cfg, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := diffRuns(got, want); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTopologySlowsAgreement(t *testing.T) {
+	cfg := testConfig(t, 12, 100, 1)
+	cfg.honestFrac = 1
+	heads := func() float64 {
+		ct, err := runSim(cfg, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, n := range ct.distinctHeads {
+			total += n
+		}
+		return float64(total) / float64(len(ct.distinctHeads))
+	}
+	without := heads()
+	var err error
+	if cfg.topology, err = parseTopology("ring", 1); err != nil {
+		t.Fatal(err)
+	}
+	if with := heads(); with <= without {
+		t.Errorf("miners on a ring saw %f heads per round, want more than the %f without a topology", with, without)
+	}
+}
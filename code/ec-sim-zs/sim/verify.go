@@ -0,0 +1,164 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+)
+
+// verifyTrackerConsistency checks that every block in ct.liveBlocksByHeight,
+// and every block they or the null blocks of ct.allBlocks name as parents,
+// is in ct.allBlocks, so that nothing drawn or written from the chain
+// dangles.  Genesis ancestors, which only exist for sampling lookback
+// tickets, and blocks below a pruned height aren't tracked.
+func verifyTrackerConsistency(ct *ChainTracker) error {
+	tracked := func(blk *Block) bool {
+		return blk.Owner == -1 || blk.Height < ct.prunedBelow || ct.allBlocks[blk.Nonce] == blk
+	}
+	for h, blocks := range ct.liveBlocksByHeight {
+		for _, blk := range blocks {
+			if !tracked(blk) {
+				return fmt.Errorf("live block %d at height %d is missing from allBlocks", blk.Nonce, h)
+			}
+		}
+	}
+	for nonce, blk := range ct.allBlocks {
+		if blk.Parents == nil {
+			continue
+		}
+		for _, parent := range blk.Parents.Blocks {
+			if !tracked(parent) {
+				return fmt.Errorf("block %d has parent %d missing from allBlocks", nonce, parent.Nonce)
+			}
+		}
+	}
+	return nil
+}
+
+// verifyHeadConsistency recomputes the heaviest tipset from scratch out of
+// every live block in ct.allBlocks and checks that it matches the head
+// setHead arrived at incrementally.  Heights are considered in order, as
+// setHead sees them, so weight ties resolve the same way.  Under GHOST,
+// which already walks every live block from genesis, the GHOST head is
+// recomputed instead.
+func verifyHeadConsistency(ct *ChainTracker) error {
+	if ct.forkChoice == ghostChoice {
+		head := newGhostTree(ct).head()
+		if head.Name != ct.head.Name {
+			return fmt.Errorf("recomputed GHOST head %s differs from tracked head %s", head.Name, ct.head.Name)
+		}
+		return nil
+	}
+
+	byHeight := make(map[int][]*Block)
+	for _, blk := range ct.allBlocks {
+		if !blk.Null {
+			byHeight[blk.Height] = append(byHeight[blk.Height], blk)
+		}
+	}
+	heights := make([]int, 0, len(byHeight))
+	for h, blocks := range byHeight {
+		heights = append(heights, h)
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i].Nonce < blocks[j].Nonce })
+	}
+	sort.Ints(heights)
+	if len(heights) == 0 {
+		return fmt.Errorf("no live blocks to recompute the head from")
+	}
+
+	var head *Tipset
+	for _, h := range heights {
+		tipsets := ct.allTipsets(byHeight[h])
+		if head == nil {
+			head = tipsets[0]
+		}
+		head = ct.heaviestTipset(head, tipsets)
+	}
+	if head.Name != ct.head.Name {
+		return fmt.Errorf("recomputed head %s (weight %d) differs from tracked head %s (weight %d)", head.Name, head.Weight, ct.head.Name, ct.head.Weight)
+	}
+	return nil
+}
+
+// verifyWeightMonotonic walks the head's ancestry and checks that every live
+// tipset outweighs its live parents, since its own blocks add weight.  Null
+// tipsets carry their parents' weight and are skipped over.
+func verifyWeightMonotonic(ct *ChainTracker) error {
+	for ts := ct.head; ts.Blocks[0].Owner != -1 && ts.getHeight() > ct.prunedBelow; ts = ts.getParents() {
+		if ts.Blocks[0].Null {
+			continue
+		}
+		parents := ts.Blocks[0].liveParents()
+		if ts.Weight <= parents.Weight {
+			return fmt.Errorf("tipset %s at height %d has weight %d, not above its parents %s (weight %d)", ts.Name, ts.getHeight(), ts.Weight, parents.Name, parents.Weight)
+		}
+	}
+	return nil
+}
+
+// validateChain checks a chain, typically one read back with loadChain,
+// against the consensus rules and returns every violation found: each mined
+// block must sit one height above its parents, carry the ticket its owner's
+// VRF derives from its parents, record its live parents' weight and be null
+// exactly when it has no election wins.  A block that won must carry the
+// election proof its owner's VRF derives from the ticket of its lookback
+// tipset.  Whether the proof should have won isn't checked, as miners'
+// powers may have changed over the run.  The head must then be the one fork
+// choice picks.
+func validateChain(ct *ChainTracker) []error {
+	blocks := make([]*Block, 0, len(ct.allBlocks)+len(ct.pending))
+	for _, blk := range ct.allBlocks {
+		blocks = append(blocks, blk)
+	}
+	blocks = append(blocks, ct.pending...)
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Nonce < blocks[j].Nonce })
+	// chains written before election proofs were saved carry none
+	proofs := false
+	for _, blk := range blocks {
+		if blk.ElectionProof != 0 {
+			proofs = true
+			break
+		}
+	}
+
+	var errs []error
+	for _, blk := range blocks {
+		// genesis and its ancestors aren't mined
+		if blk.Owner == -1 {
+			continue
+		}
+		if blk.Parents == nil {
+			errs = append(errs, fmt.Errorf("block %d has no parents", blk.Nonce))
+			continue
+		}
+		if h := blk.Parents.getHeight(); blk.Height != h+1 {
+			errs = append(errs, fmt.Errorf("block %d at height %d has parents %s at height %d", blk.Nonce, blk.Height, blk.Parents.Name, h))
+		}
+		vrf := &RationalMiner{MinerID: blk.Owner, TicketSpace: ct.ticketSpace}
+		if t := vrf.generateTicket(blk.Parents.MinTicket); blk.Seed != t {
+			errs = append(errs, fmt.Errorf("block %d has ticket %d, miner %d derives %d from its parents", blk.Nonce, blk.Seed, blk.Owner, t))
+		}
+		if w := blk.liveParents().Weight; blk.ParentWeight != w {
+			errs = append(errs, fmt.Errorf("block %d has parent weight %d, its live parents weigh %d", blk.Nonce, blk.ParentWeight, w))
+		}
+		if blk.Null != (blk.WinCount == 0) {
+			errs = append(errs, fmt.Errorf("block %d is null %t with %d election wins", blk.Nonce, blk.Null, blk.WinCount))
+		}
+		if proofs && !blk.Null {
+			lookback := lookbackTipset(blk.Parents, ct.lbps.at(blk.Parents.getHeight()))
+			if p := vrf.generateTicket(lookback.MinTicket); blk.ElectionProof != p {
+				errs = append(errs, fmt.Errorf("block %d has election proof %d, miner %d derives %d from the ticket of its lookback %s", blk.Nonce, blk.ElectionProof, blk.Owner, p, lookback.Name))
+			}
+		}
+		if t := blk.Parents.Blocks[0].Timestamp + ct.blockTime; blk.Timestamp != t {
+			errs = append(errs, fmt.Errorf("block %d has timestamp %s, expected %s after its parents", blk.Nonce, blk.Timestamp, t))
+		}
+	}
+
+	if err := verifyHeadConsistency(ct); err != nil {
+		errs = append(errs, err)
+	}
+	if err := verifyWeightMonotonic(ct); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
@@ -0,0 +1,63 @@
+package sim
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateChain(t *testing.T) {
+	cfg := testConfig(t, 8, 40, 3)
+	ct, err := runSim(cfg, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeChain(ct, "chain", dir)
+
+	// a block that won, deep enough for its lookback to differ from its
+	// parents
+	winner := func(ct *ChainTracker) *Block {
+		for h := 10; ; h++ {
+			if blocks := ct.liveBlocksByHeight[h]; len(blocks) > 0 {
+				return blocks[0]
+			}
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		tamper func(ct *ChainTracker, blk *Block)
+		// substring of the violation found, none if empty
+		want string
+	}{
+		{"untouched", func(*ChainTracker, *Block) {}, ""},
+		{"forged ticket", func(_ *ChainTracker, blk *Block) { blk.Seed++ }, "has ticket"},
+		{"forged election proof", func(_ *ChainTracker, blk *Block) { blk.ElectionProof++ }, "has election proof"},
+		{"election proof from the parents", func(ct *ChainTracker, blk *Block) {
+			vrf := &RationalMiner{MinerID: blk.Owner, TicketSpace: ct.ticketSpace}
+			blk.ElectionProof = vrf.generateTicket(blk.Parents.MinTicket)
+		}, "from the ticket of its lookback"},
+		{"wins without a proof", func(_ *ChainTracker, blk *Block) { blk.ElectionProof = 0 }, "has election proof 0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			loaded, err := loadChain(filepath.Join(dir, "chain.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.tamper(loaded, winner(loaded))
+			errs := validateChain(loaded)
+			if tc.want == "" {
+				for _, err := range errs {
+					t.Error(err)
+				}
+				return
+			}
+			for _, err := range errs {
+				if strings.Contains(err.Error(), tc.want) {
+					return
+				}
+			}
+			t.Errorf("violations %v, want one with %q", errs, tc.want)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+)
+
+// WeightFunc returns the weight of a tipset given the weight of its live
+// parents and its number of live blocks (counting each block once per
+// election win).
+type WeightFunc func(parentWeight, numLiveBlocks int) int
+
+// additiveWeight adds one per live block: the default
+func additiveWeight(parentWeight, numLiveBlocks int) int {
+	return parentWeight + numLiveBlocks
+}
+
+// discountWeight adds ceil(log2(n+1)) for n live blocks, so each additional
+// block in a tipset counts for less
+func discountWeight(parentWeight, numLiveBlocks int) int {
+	return parentWeight + int(math.Ceil(math.Log2(float64(numLiveBlocks+1))))
+}
+
+// logWeightScale keeps fractional log weights distinguishable as integers
+const logWeightScale = 256
+
+// logWeight adds logWeightScale*log2(n+1) for n live blocks, after EC's
+// weight formula with its log term
+func logWeight(parentWeight, numLiveBlocks int) int {
+	return parentWeight + int(math.Round(logWeightScale*math.Log2(float64(numLiveBlocks+1))))
+}
+
+// setWeight has the chain weigh its tipsets with the built-in weight
+// function with the given name
+func (ct *ChainTracker) setWeight(name string) error {
+	wf, err := parseWeightFunc(name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = "additive"
+	}
+	ct.weight, ct.weightName = wf, name
+	return nil
+}
+
+// parseWeightFunc returns the built-in weight function with the given name
+func parseWeightFunc(name string) (WeightFunc, error) {
+	switch name {
+	case "", "additive":
+		return additiveWeight, nil
+	case "discount":
+		return discountWeight, nil
+	case "log":
+		return logWeight, nil
+	}
+	return nil, fmt.Errorf("unknown weight function %q: must be additive, discount or log", name)
+}